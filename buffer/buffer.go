@@ -1,32 +1,68 @@
 package buffer
 
 import (
+	"context"
 	"ddai-go/file"
+	"ddai-go/log"
 	"errors"
 	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// Buffer holds the contents of a block in memory.
+//
+// The contents, txNum and lsn are guarded by the latch of the buffer:
+// readers of Contents must hold RLock, and writers must hold Lock while modifying it and calling SetModified.
+// txNum and lsn are also atomic, so that Stats and Buffers read them without waiting for the latch.
+// Block, pins, loading and prefetched are guarded by the pool latch of the Manager, and Block never changes
+// while the buffer is pinned, except when the Manager assigns the block that a loading buffer has read.
 type Buffer struct {
 	fileManager *file.Manager
+	logManager  *log.Manager
 	Contents    *file.Page
 	Block       file.BlockID
 	pins        int32
-	txNum       int32
-	lsn         int32
+	loading     bool // true while the buffer is written and read without the pool latch
+	prefetched  bool // true if the block was read ahead and has not been pinned since
+	txNum       atomic.Int32
+	lsn         atomic.Int32
+	latch       sync.RWMutex
 }
 
-func NewBuffer(fm *file.Manager) *Buffer {
-	return &Buffer{
+func NewBuffer(fm *file.Manager, lm *log.Manager) *Buffer {
+	b := &Buffer{
 		fileManager: fm,
-		txNum:       -1,
+		logManager:  lm,
 		Contents:    file.NewPage(fm.BlockSize),
 	}
+	b.txNum.Store(-1)
+	return b
 }
 
+func (b *Buffer) Lock() {
+	b.latch.Lock()
+}
+
+func (b *Buffer) Unlock() {
+	b.latch.Unlock()
+}
+
+func (b *Buffer) RLock() {
+	b.latch.RLock()
+}
+
+func (b *Buffer) RUnlock() {
+	b.latch.RUnlock()
+}
+
+// SetModified records that the transaction modified the contents, with the LSN of the log record of the modification.
+// The caller must hold the latch.
 func (b *Buffer) SetModified(txNum int32, lsn int32) {
-	b.txNum = txNum
+	b.txNum.Store(txNum)
 	if lsn > 0 {
-		b.lsn = lsn
+		b.lsn.Store(lsn)
 	}
 }
 
@@ -42,107 +78,434 @@ func (b *Buffer) IsPinned() bool {
 	return b.pins > 0
 }
 
+// AssignToBlock writes the buffer to disk if it is modified, and reads the block into it.
+// If the write fails, the buffer keeps its block and its modified contents;
+// if the read fails, the buffer is no longer assigned to any block.
 func (b *Buffer) AssignToBlock(blk file.BlockID) error {
+	written, err := b.replace(blk)
+	switch {
+	case err == nil:
+		b.Block = blk
+	case written:
+		b.Block = file.BlockID{}
+	}
+	return err
+}
+
+// replace writes the buffer to disk if it is modified, and reads the block into its contents,
+// leaving Block to the caller. written reports whether the old contents are no longer needed,
+// i.e. whether the write succeeded, even if the read then failed.
+func (b *Buffer) replace(blk file.BlockID) (written bool, err error) {
+	b.latch.Lock()
+	defer b.latch.Unlock()
+
 	if err := b.flush(); err != nil {
-		return fmt.Errorf("buffer.flush: %w", err)
+		return false, fmt.Errorf("buffer.flush: %w", err)
 	}
-	b.Block = blk
 	if err := b.fileManager.Load(blk, b.Contents); err != nil {
-		return fmt.Errorf("file.Load: %w", err)
+		return true, fmt.Errorf("file.Load: %w", err)
 	}
-	b.pins = 0
-	return nil
+	return true, nil
 }
 
+// flush writes the modified page to disk.
+// The log records up to the latest modification are flushed first (write-ahead logging),
+// so that the modification can always be undone after a crash.
+// The caller must hold the latch.
 func (b *Buffer) flush() error {
-	if b.txNum <= 0 {
+	if b.txNum.Load() <= 0 {
 		return nil
 	}
+	if err := b.logManager.Flush(b.lsn.Load()); err != nil {
+		return fmt.Errorf("log.Flush: %w", err)
+	}
 	if err := b.fileManager.Save(b.Block, b.Contents); err != nil {
 		return fmt.Errorf("file.Save: %w", err)
 	}
-	b.txNum = -1
+	b.txNum.Store(-1)
 	return nil
 }
 
+// defaultMaxWaitTime is how long Pin waits for a buffer to be released before giving up.
+const defaultMaxWaitTime = 10 * time.Second
+
+// Manager pins blocks to the buffers of the pool, and is safe for concurrent use.
+// The pins of the buffers are guarded by the pool latch (the lock of cond),
+// which is always acquired before the latch of a buffer.
 type Manager struct {
+	fileManager  *file.Manager
 	bufferPool   []*Buffer
+	resident     map[file.BlockID]*Buffer
+	free         []*Buffer // buffers not assigned to any block
 	numAvailable int32
+	maxWaitTime  time.Duration
+	policy       ReplacementPolicy
+	counters     counters
+	cond         *sync.Cond
+
+	maxPinsPerTx int
+	owners       map[int32]map[*Buffer]int32 // the pins held by each transaction
+	leakHandler  func(txNum int32, blocks []file.BlockID)
+
+	readAhead int32
+	sequences map[string]sequence // the sequential access of each file, for read-ahead
+
+	writerInterval time.Duration
+	writerMaxPages int
+	writerCursor   int // where the next round of the background writer starts
+	writerErr      error
+	done           chan struct{}
+	closeOnce      sync.Once
+	wg             sync.WaitGroup
 }
 
-func NewManager(fm *file.Manager, buffSize int32) *Manager {
+// Option configures a Manager.
+type Option func(*Manager)
+
+// WithMaxWaitTime sets how long Pin waits for a buffer to be released before returning ErrBufferAbort.
+func WithMaxWaitTime(d time.Duration) Option {
+	return func(bm *Manager) {
+		bm.maxWaitTime = d
+	}
+}
+
+// WithReplacementPolicy sets the policy choosing the buffer to replace. The default is NewLRUPolicy().
+// A policy must not be shared between Managers.
+func WithReplacementPolicy(p ReplacementPolicy) Option {
+	return func(bm *Manager) {
+		bm.policy = p
+	}
+}
+
+// WithBackgroundWriter starts a goroutine that writes up to maxPages modified unpinned buffers to disk every interval,
+// so that fewer buffers have to be written when they are replaced or their transaction commits.
+// The goroutine runs until Close is called.
+func WithBackgroundWriter(interval time.Duration, maxPages int) Option {
+	return func(bm *Manager) {
+		bm.writerInterval = interval
+		bm.writerMaxPages = maxPages
+	}
+}
+
+func NewManager(fm *file.Manager, lm *log.Manager, buffSize int32, opts ...Option) *Manager {
 	bufferPool := make([]*Buffer, buffSize)
 	for i := range bufferPool {
-		bufferPool[i] = NewBuffer(fm)
+		bufferPool[i] = NewBuffer(fm, lm)
 	}
 
-	return &Manager{
+	free := make([]*Buffer, buffSize)
+	copy(free, bufferPool)
+
+	bm := &Manager{
+		fileManager:  fm,
 		bufferPool:   bufferPool,
+		resident:     make(map[file.BlockID]*Buffer, buffSize),
+		free:         free,
 		numAvailable: buffSize,
+		maxWaitTime:  defaultMaxWaitTime,
+		policy:       NewLRUPolicy(),
+		cond:         sync.NewCond(&sync.Mutex{}),
+		owners:       make(map[int32]map[*Buffer]int32),
+		sequences:    make(map[string]sequence),
+		done:         make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(bm)
+	}
+	bm.policy.Init(bufferPool)
+	if bm.writerInterval > 0 && bm.writerMaxPages > 0 {
+		bm.wg.Add(1)
+		go bm.runWriter()
+	}
+	return bm
+}
+
+// Close stops the background writer and waits for the running prefetches, and returns the last error it met, if any.
+// The buffers are not written to disk; those modified by committed transactions already are.
+func (bm *Manager) Close() error {
+	bm.closeOnce.Do(func() {
+		close(bm.done)
+	})
+	bm.wg.Wait()
+	return bm.writerErr
+}
+
+func (bm *Manager) runWriter() {
+	defer bm.wg.Done()
+
+	ticker := time.NewTicker(bm.writerInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-bm.done:
+			return
+		case <-ticker.C:
+			// a buffer that failed to be written stays modified,
+			// and the error is met again when the buffer is replaced or flushed at commit
+			if err := bm.writeModifiedBuffers(); err != nil {
+				bm.writerErr = err
+			}
+		}
+	}
+}
+
+// writeModifiedBuffers writes up to writerMaxPages modified unpinned buffers,
+// going round the pool from where the previous round stopped.
+// Only the pins are read under the pool latch, so that pinning is not blocked by the disk writes.
+func (bm *Manager) writeModifiedBuffers() error {
+	n := len(bm.bufferPool)
+	var unpinned []int
+	bm.cond.L.Lock()
+	for i := range n {
+		j := (bm.writerCursor + i) % n
+		if !bm.bufferPool[j].IsPinned() {
+			unpinned = append(unpinned, j)
+		}
+	}
+	bm.cond.L.Unlock()
+
+	written := 0
+	for _, i := range unpinned {
+		if written >= bm.writerMaxPages {
+			break
+		}
+		ok, err := bm.writeIfModified(bm.bufferPool[i])
+		if err != nil {
+			return err
+		}
+		if ok {
+			written++
+			bm.writerCursor = (i + 1) % n
+		}
+	}
+	return nil
+}
+
+// writeIfModified writes the buffer to disk if it is modified.
+// The buffer may have been pinned since it was chosen, which is fine because its contents are consistent under the latch.
+func (bm *Manager) writeIfModified(buf *Buffer) (bool, error) {
+	buf.latch.Lock()
+	defer buf.latch.Unlock()
+
+	if buf.txNum.Load() <= 0 {
+		return false, nil
+	}
+	if err := buf.flush(); err != nil {
+		return false, fmt.Errorf("buffer.flush: %w", err)
 	}
+	return true, nil
 }
 
+// FlushAll writes the buffers modified by the transaction to disk.
+// It holds only the latch of each buffer in turn, so other goroutines can keep pinning buffers meanwhile.
 func (bm *Manager) FlushAll(txNum int32) error {
 	for _, buf := range bm.bufferPool {
-		if buf.txNum == txNum {
-			if err := buf.flush(); err != nil {
-				return fmt.Errorf("buffer.flush: %w", err)
-			}
+		if err := bm.flushIfModifiedBy(buf, txNum); err != nil {
+			return err
 		}
 	}
 	return nil
 }
 
+func (bm *Manager) flushIfModifiedBy(buf *Buffer, txNum int32) error {
+	buf.latch.Lock()
+	defer buf.latch.Unlock()
+
+	if buf.txNum.Load() != txNum {
+		return nil
+	}
+	if err := buf.flush(); err != nil {
+		return fmt.Errorf("buffer.flush: %w", err)
+	}
+	return nil
+}
+
 func (bm *Manager) NumAvailable() int32 {
+	bm.cond.L.Lock()
+	defer bm.cond.L.Unlock()
+
 	return bm.numAvailable
 }
 
+// Hits returns how many times a pinned block was already in the pool, without counting the first pins of the blocks read ahead.
+func (bm *Manager) Hits() int64 {
+	bm.cond.L.Lock()
+	defer bm.cond.L.Unlock()
+
+	return bm.counters.hits
+}
+
+// Misses returns how many times a pinned block had to be read into a replaced buffer.
+func (bm *Manager) Misses() int64 {
+	bm.cond.L.Lock()
+	defer bm.cond.L.Unlock()
+
+	return bm.counters.misses
+}
+
 var ErrBufferAbort = errors.New("buffer pinning aborted")
 
+// Pin pins a buffer to the block.
+// If no buffer is available, it waits until one is released,
+// and returns ErrBufferAbort if none is released within the max wait time.
 func (bm *Manager) Pin(blk file.BlockID) (*Buffer, error) {
-	buff, err := bm.tryToPin(blk)
-	if err != nil {
-		return nil, fmt.Errorf("buffer.tryToPin: %w", err)
-	}
-	if buff == nil {
-		return nil, ErrBufferAbort
+	return bm.PinContext(context.Background(), blk)
+}
+
+// PinContext is like Pin, but also stops waiting when the context is done.
+// The returned error then wraps both ErrBufferAbort and the error of the context.
+func (bm *Manager) PinContext(ctx context.Context, blk file.BlockID) (*Buffer, error) {
+	bm.cond.L.Lock()
+	defer bm.cond.L.Unlock()
+
+	return bm.pin(ctx, blk)
+}
+
+// pin is the body of PinContext. The caller must hold the pool latch.
+func (bm *Manager) pin(ctx context.Context, blk file.BlockID) (*Buffer, error) {
+	// wake up the waiting goroutine when the context is done
+	stop := context.AfterFunc(ctx, func() {
+		bm.cond.L.Lock()
+		defer bm.cond.L.Unlock()
+		bm.cond.Broadcast()
+	})
+	defer stop()
+
+	deadline := time.Now().Add(bm.maxWaitTime)
+	waited := false
+	for {
+		buff, err := bm.tryToPin(blk)
+		if err != nil {
+			return nil, fmt.Errorf("buffer.tryToPin: %w", err)
+		}
+		if buff != nil {
+			return buff, nil
+		}
+		if err := ctx.Err(); err != nil {
+			bm.counters.pinAborts++
+			return nil, fmt.Errorf("%w: %w", ErrBufferAbort, err)
+		}
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			bm.counters.pinAborts++
+			return nil, ErrBufferAbort
+		}
+		if !waited {
+			bm.counters.pinWaits++
+			waited = true
+		}
+		bm.waitWithTimeout(remaining)
 	}
-	return buff, nil
 }
 
 func (bm *Manager) Unpin(buff *Buffer) {
+	bm.cond.L.Lock()
+	defer bm.cond.L.Unlock()
+
+	bm.unpin(buff)
+}
+
+// unpin releases a pin of the buffer. The caller must hold the pool latch.
+func (bm *Manager) unpin(buff *Buffer) {
 	buff.Unpin()
 	if !buff.IsPinned() {
 		bm.numAvailable++
-		// TODO: notifyAll();
+		bm.policy.Unpinned(buff)
+		bm.cond.Broadcast()
 	}
 }
 
+func (bm *Manager) waitWithTimeout(timeout time.Duration) {
+	timer := time.AfterFunc(timeout, func() {
+		bm.cond.L.Lock()
+		defer bm.cond.L.Unlock()
+		bm.cond.Broadcast()
+	})
+	bm.cond.Wait()
+	timer.Stop()
+}
+
 func (bm *Manager) tryToPin(blk file.BlockID) (*Buffer, error) {
-	var buffer *Buffer
-	// find existing buffer
-	for _, buf := range bm.bufferPool {
-		if b := buf.Block; b == blk {
-			buffer = buf
-		}
+	buffer, hit := bm.resident[blk]
+	if hit && buffer.loading {
+		// wait for the loading, which may fail
+		return nil, nil
 	}
-	if buffer == nil {
-		// choose unpinned buffer
-		for _, buf := range bm.bufferPool {
-			if !buf.IsPinned() {
-				buffer = buf
-			}
-		}
+	if !hit {
+		buffer = bm.chooseUnpinnedBuffer()
 		if buffer == nil {
 			return nil, nil
 		}
-		if err := buffer.AssignToBlock(blk); err != nil {
-			return nil, fmt.Errorf("buffer.AssignToBlock: %w", err)
+		if err := bm.assignToBlock(buffer, blk); err != nil {
+			return nil, err
 		}
+		bm.detectSequentialAccess(blk)
+		return buffer, nil
+	}
+	// the first pin of a block read ahead is its first use
+	first := buffer.prefetched
+	if first {
+		buffer.prefetched = false
+		bm.counters.prefetchHits++
+	} else {
+		bm.counters.hits++
 	}
 	if !buffer.IsPinned() {
 		bm.numAvailable--
 	}
 	buffer.Pin()
+	bm.policy.Pinned(buffer, !first)
+	bm.detectSequentialAccess(blk)
 	return buffer, nil
 }
+
+// assignToBlock assigns the unpinned buffer to the block, and pins it.
+// The caller must hold the pool latch, which is released while the buffer is written and read,
+// so that the other pins do not wait for the disk; meanwhile the buffer is loading,
+// and the pins of both the old and the new block wait for it.
+func (bm *Manager) assignToBlock(buf *Buffer, blk file.BlockID) error {
+	old := buf.Block
+	buf.loading = true
+	buf.prefetched = false
+	bm.resident[blk] = buf
+	buf.Pin()
+	bm.numAvailable--
+
+	bm.cond.L.Unlock()
+	written, err := buf.replace(blk)
+	bm.cond.L.Lock()
+
+	buf.loading = false
+	if err != nil {
+		delete(bm.resident, blk)
+		if written {
+			// the read failed after the old block was written
+			delete(bm.resident, old)
+			buf.Block = file.BlockID{}
+			bm.free = append(bm.free, buf)
+		}
+		// otherwise the write failed, and the buffer still holds the modified old block
+		bm.unpin(buf)
+		return fmt.Errorf("buffer.replace: %w", err)
+	}
+	buf.Block = blk
+	if old != (file.BlockID{}) {
+		delete(bm.resident, old)
+		bm.counters.evictions++
+	}
+	bm.counters.misses++
+	bm.policy.Pinned(buf, false)
+	bm.cond.Broadcast()
+	return nil
+}
+
+// chooseUnpinnedBuffer returns a buffer not assigned to any block if any,
+// and otherwise the victim of the replacement policy.
+func (bm *Manager) chooseUnpinnedBuffer() *Buffer {
+	if n := len(bm.free); n > 0 {
+		buf := bm.free[n-1]
+		bm.free = bm.free[:n-1]
+		return buf
+	}
+	return bm.policy.Victim()
+}
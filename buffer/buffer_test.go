@@ -1,13 +1,17 @@
 package buffer_test
 
 import (
+	"context"
 	"ddai-go/buffer"
 	"ddai-go/file"
 	"ddai-go/server"
 	"errors"
 	"fmt"
 	"path"
+	"slices"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestBuffer(t *testing.T) {
@@ -69,12 +73,13 @@ func TestBuffer(t *testing.T) {
 func TestBufferManager(t *testing.T) {
 	t.Parallel()
 
-	db, err := server.NewSimpleDB(path.Join(t.TempDir(), "buffermgrtest"), 400, 3) // only 3 buffers
+	db, err := server.NewSimpleDB(path.Join(t.TempDir(), "buffermgrtest"), 400, 3)
 	if err != nil {
 		t.Fatalf("NewSimpleDB: %v", err)
 	}
 
-	bm := db.BufferManager
+	// only 3 buffers, and give up pinning quickly
+	bm := buffer.NewManager(db.FileManager, db.LogManager, 3, buffer.WithMaxWaitTime(100*time.Millisecond))
 
 	buff := [6]*buffer.Buffer{}
 	buff[0], err = bm.Pin(file.NewBlockID("testfile", 0))
@@ -124,7 +129,7 @@ func TestBufferManager(t *testing.T) {
 		t.Fatalf("bm.Pin: %v", err)
 	}
 
-	wants := []int64{0, -1, -1, 0, 1, 3}
+	wants := []int32{0, -1, -1, 0, 1, 3}
 	fmt.Println("Final Buffer Allocation:")
 	for i, b := range buff {
 		if b != nil {
@@ -145,3 +150,852 @@ func TestBufferManager(t *testing.T) {
 		fmt.Printf("buff[%d] pinned to block %v\n", i, b.Block)
 	}
 }
+
+func TestBufferWriteAheadLog(t *testing.T) {
+	t.Parallel()
+
+	dbDir := path.Join(t.TempDir(), "waltest")
+	db, err := server.NewSimpleDB(dbDir, 400, 3) // only 3 buffers
+	if err != nil {
+		t.Fatalf("NewSimpleDB: %v", err)
+	}
+	blk := file.NewBlockID("testfile", 0)
+
+	tx1 := db.NewTx()
+	if err := tx1.Pin(blk); err != nil {
+		t.Fatalf("tx1.Pin: %v", err)
+	}
+	if err := tx1.SetInt(blk, 80, 111, true); err != nil {
+		t.Fatalf("tx1.SetInt: %v", err)
+	}
+	if err := tx1.Commit(); err != nil {
+		t.Fatalf("tx1.Commit: %v", err)
+	}
+
+	// the modification of the uncommitted tx2 is written to disk when its buffer is replaced,
+	// while the log record holding the old value is still in memory
+	tx2 := db.NewTx()
+	if err := tx2.Pin(blk); err != nil {
+		t.Fatalf("tx2.Pin: %v", err)
+	}
+	if err := tx2.SetInt(blk, 80, 222, true); err != nil {
+		t.Fatalf("tx2.SetInt: %v", err)
+	}
+	if err := tx2.Unpin(blk); err != nil {
+		t.Fatalf("tx2.Unpin: %v", err)
+	}
+	for i := range int32(3) {
+		if _, err := db.BufferManager.Pin(file.NewBlockID("otherfile", i)); err != nil {
+			t.Fatalf("bm.Pin: %v", err)
+		}
+	}
+	p := file.NewPage(400)
+	if err := db.FileManager.Load(blk, p); err != nil {
+		t.Fatalf("fm.Load: %v", err)
+	}
+	if got := p.GetInt(80); got != 222 {
+		t.Fatalf("value on disk=%d, want 222", got)
+	}
+
+	// crash: forget everything in memory, and recover from the disk
+	db, err = server.NewSimpleDB(dbDir, 400, 3)
+	if err != nil {
+		t.Fatalf("NewSimpleDB: %v", err)
+	}
+	tx3 := db.NewTx()
+	if err := tx3.Recover(); err != nil {
+		t.Fatalf("tx3.Recover: %v", err)
+	}
+	if err := db.FileManager.Load(blk, p); err != nil {
+		t.Fatalf("fm.Load: %v", err)
+	}
+	if got := p.GetInt(80); got != 111 {
+		t.Errorf("value on disk after recovery=%d, want 111", got)
+	}
+}
+
+func TestBufferManagerFailedWrite(t *testing.T) {
+	t.Parallel()
+
+	vfs := file.NewFaultVFS(file.NewMemVFS())
+	db, err := server.NewSimpleDB("failedwritetest", 400, 3, server.WithFileOptions(file.WithVFS(vfs)))
+	if err != nil {
+		t.Fatalf("NewSimpleDB: %v", err)
+	}
+	bm := buffer.NewManager(db.FileManager, db.LogManager, 1, buffer.WithMaxWaitTime(100*time.Millisecond))
+	blk0, blk1 := file.NewBlockID("testfile", 0), file.NewBlockID("testfile", 1)
+
+	buff, err := bm.Pin(blk0)
+	if err != nil {
+		t.Fatalf("bm.Pin: %v", err)
+	}
+	buff.Lock()
+	buff.Contents.SetInt(80, 111)
+	buff.SetModified(1, 0)
+	buff.Unlock()
+	bm.Unpin(buff)
+
+	// the modified block cannot be written, so its buffer is not replaced
+	vfs.FailWrites(blk0)
+	if _, err := bm.Pin(blk1); err == nil {
+		t.Fatalf("bm.Pin: no error while the replaced block cannot be written")
+	}
+	vfs.ClearFaults()
+
+	// the block is still in the pool, so that no other buffer reads an older version of it
+	hits := bm.Stats().Hits
+	buff, err = bm.Pin(blk0)
+	if err != nil {
+		t.Fatalf("bm.Pin: %v", err)
+	}
+	if got := bm.Stats().Hits; got != hits+1 {
+		t.Errorf("hits=%d, want %d", got, hits+1)
+	}
+	if got := buff.Contents.GetInt(80); got != 111 {
+		t.Fatalf("value after the failed write=%d, want the modified 111", got)
+	}
+	bm.Unpin(buff)
+
+	// the buffer is written when it is replaced again
+	buff, err = bm.Pin(blk1)
+	if err != nil {
+		t.Fatalf("bm.Pin: %v", err)
+	}
+	bm.Unpin(buff)
+	p := file.NewPage(400)
+	if err := db.FileManager.Load(blk0, p); err != nil {
+		t.Fatalf("fm.Load: %v", err)
+	}
+	if got := p.GetInt(80); got != 111 {
+		t.Errorf("value on disk=%d, want 111", got)
+	}
+}
+
+// slowVFS blocks the reads of the files with the name until release is closed.
+type slowVFS struct {
+	file.VFS
+	name    string
+	started chan struct{}
+	release chan struct{}
+}
+
+func (v *slowVFS) OpenFile(name string) (file.VFile, error) {
+	f, err := v.VFS.OpenFile(name)
+	if err != nil || path.Base(name) != v.name {
+		return f, err
+	}
+	return &slowFile{VFile: f, vfs: v}, nil
+}
+
+type slowFile struct {
+	file.VFile
+	vfs  *slowVFS
+	once sync.Once
+}
+
+func (f *slowFile) ReadAt(p []byte, off int64) (int, error) {
+	f.once.Do(func() { close(f.vfs.started) })
+	<-f.vfs.release
+	return f.VFile.ReadAt(p, off)
+}
+
+func TestBufferManagerPinDuringRead(t *testing.T) {
+	t.Parallel()
+
+	vfs := &slowVFS{VFS: file.NewMemVFS(), name: "slowfile", started: make(chan struct{}), release: make(chan struct{})}
+	db, err := server.NewSimpleDB("slowreadtest", 400, 3, server.WithFileOptions(file.WithVFS(vfs)))
+	if err != nil {
+		t.Fatalf("NewSimpleDB: %v", err)
+	}
+	bm := buffer.NewManager(db.FileManager, db.LogManager, 2)
+	blk := file.NewBlockID("testfile", 0)
+	buff, err := bm.Pin(blk)
+	if err != nil {
+		t.Fatalf("bm.Pin: %v", err)
+	}
+	bm.Unpin(buff)
+
+	errc := make(chan error, 1)
+	go func() {
+		buff, err := bm.Pin(file.NewBlockID("slowfile", 0))
+		if err == nil {
+			bm.Unpin(buff)
+		}
+		errc <- err
+	}()
+	<-vfs.started
+
+	// the block in the pool is pinned while the other one is read
+	pinned := make(chan error, 1)
+	go func() {
+		buff, err := bm.Pin(blk)
+		if err == nil {
+			bm.Unpin(buff)
+		}
+		pinned <- err
+	}()
+	select {
+	case err := <-pinned:
+		if err != nil {
+			t.Errorf("bm.Pin: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("bm.Pin of a block in the pool waited for the read of another block")
+	}
+
+	close(vfs.release)
+	if err := <-errc; err != nil {
+		t.Errorf("bm.Pin: %v", err)
+	}
+}
+
+func TestBufferManagerWaitsForUnpin(t *testing.T) {
+	t.Parallel()
+
+	db, err := server.NewSimpleDB(path.Join(t.TempDir(), "buffermgrwaittest"), 400, 2)
+	if err != nil {
+		t.Fatalf("NewSimpleDB: %v", err)
+	}
+	bm := db.BufferManager
+
+	buff0, err := bm.Pin(file.NewBlockID("testfile", 0))
+	if err != nil {
+		t.Fatalf("bm.Pin: %v", err)
+	}
+	if _, err := bm.Pin(file.NewBlockID("testfile", 1)); err != nil {
+		t.Fatalf("bm.Pin: %v", err)
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		bm.Unpin(buff0)
+	}()
+
+	start := time.Now()
+	buff2, err := bm.Pin(file.NewBlockID("testfile", 2)) // blocks until buff0 is unpinned
+	if err != nil {
+		t.Fatalf("bm.Pin: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("bm.Pin returned after %v, before the buffer was released", elapsed)
+	}
+	if buff2.Block.Index != 2 {
+		t.Errorf("pinned block %d, want 2", buff2.Block.Index)
+	}
+}
+
+func TestBufferManagerPinContext(t *testing.T) {
+	t.Parallel()
+
+	db, err := server.NewSimpleDB(path.Join(t.TempDir(), "buffermgrctxtest"), 400, 1)
+	if err != nil {
+		t.Fatalf("NewSimpleDB: %v", err)
+	}
+	bm := db.BufferManager
+
+	if _, err := bm.Pin(file.NewBlockID("testfile", 0)); err != nil {
+		t.Fatalf("bm.Pin: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err = bm.PinContext(ctx, file.NewBlockID("testfile", 1))
+	if !errors.Is(err, buffer.ErrBufferAbort) || !errors.Is(err, context.Canceled) {
+		t.Fatalf("bm.PinContext err=%v, want ErrBufferAbort and context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("bm.PinContext returned after %v, long after the context was canceled", elapsed)
+	}
+}
+
+func TestBufferManagerConcurrentPins(t *testing.T) {
+	t.Parallel()
+
+	db, err := server.NewSimpleDB(path.Join(t.TempDir(), "buffermgrstresstest"), 400, 10)
+	if err != nil {
+		t.Fatalf("NewSimpleDB: %v", err)
+	}
+	bm := db.BufferManager
+
+	const (
+		numGoroutines = 300
+		numPins       = 50
+		numBlocks     = 25 // more blocks than buffers, so that buffers are replaced
+	)
+	var wg sync.WaitGroup
+	errs := make(chan error, numGoroutines)
+	for g := range numGoroutines {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range numPins {
+				blk := file.NewBlockID("testfile", int32((g+i)%numBlocks))
+				buff, err := bm.Pin(blk)
+				if err != nil {
+					errs <- err
+					return
+				}
+				if buff.Block != blk {
+					errs <- fmt.Errorf("pinned %v, want %v", buff.Block, blk)
+				}
+				buff.Lock()
+				buff.Contents.SetInt(0, buff.Contents.GetInt(0)+1)
+				buff.SetModified(1, 0)
+				buff.Unlock()
+				bm.Unpin(buff)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("goroutine failed: %v", err)
+	}
+
+	if n := bm.NumAvailable(); n != 10 {
+		t.Errorf("bm.NumAvailable()=%d, want 10", n)
+	}
+	// no increment is lost, whether it was written by a replacement or by FlushAll
+	if err := bm.FlushAll(1); err != nil {
+		t.Fatalf("bm.FlushAll: %v", err)
+	}
+	total := int32(0)
+	p := file.NewPage(400)
+	for i := range int32(numBlocks) {
+		if err := db.FileManager.Load(file.NewBlockID("testfile", i), p); err != nil {
+			t.Fatalf("fm.Load: %v", err)
+		}
+		total += p.GetInt(0)
+	}
+	if total != numGoroutines*numPins {
+		t.Errorf("total=%d, want %d", total, numGoroutines*numPins)
+	}
+}
+
+func TestReplacementPolicies(t *testing.T) {
+	t.Parallel()
+
+	// blocks 0 and 1 are pinned twice, and then a scan passes over them
+	hotTrace := []int32{0, 0, 1, 1, 2, 3, 4, 0, 1}
+	// blocks 0 and 1 are pinned again right after being replaced, and then a long scan passes
+	scanTrace := []int32{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 0, 1, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 0, 1}
+
+	tests := []struct {
+		name     string
+		policy   func() buffer.ReplacementPolicy
+		buffSize int32
+		trace    []int32
+		wantHits int64
+	}{
+		{"naive/hot", buffer.NewNaivePolicy, 3, hotTrace, 3},
+		{"lru/hot", buffer.NewLRUPolicy, 3, hotTrace, 2},
+		{"clock/hot", buffer.NewClockPolicy, 3, hotTrace, 3},
+		{"lru2/hot", func() buffer.ReplacementPolicy { return buffer.NewLRUKPolicy(2) }, 3, hotTrace, 4},
+		{"2q/hot", buffer.NewTwoQPolicy, 3, hotTrace, 2},
+		{"naive/scan", buffer.NewNaivePolicy, 8, scanTrace, 2},
+		{"lru/scan", buffer.NewLRUPolicy, 8, scanTrace, 0},
+		{"clock/scan", buffer.NewClockPolicy, 8, scanTrace, 2},
+		{"lru2/scan", func() buffer.ReplacementPolicy { return buffer.NewLRUKPolicy(2) }, 8, scanTrace, 0},
+		{"2q/scan", buffer.NewTwoQPolicy, 8, scanTrace, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			db, err := server.NewSimpleDB(path.Join(t.TempDir(), "policytest"), 400, 3)
+			if err != nil {
+				t.Fatalf("NewSimpleDB: %v", err)
+			}
+			bm := buffer.NewManager(db.FileManager, db.LogManager, tt.buffSize,
+				buffer.WithReplacementPolicy(tt.policy()),
+				buffer.WithMaxWaitTime(100*time.Millisecond))
+
+			for _, i := range tt.trace {
+				buf, err := bm.Pin(file.NewBlockID("testfile", i))
+				if err != nil {
+					t.Fatalf("bm.Pin(%d): %v", i, err)
+				}
+				bm.Unpin(buf)
+			}
+			if got := bm.Hits(); got != tt.wantHits {
+				t.Errorf("bm.Hits() = %d, want %d", got, tt.wantHits)
+			}
+			if got, want := bm.Misses(), int64(len(tt.trace))-tt.wantHits; got != want {
+				t.Errorf("bm.Misses() = %d, want %d", got, want)
+			}
+
+			// no pinned buffer is chosen for replacement
+			for i := range tt.buffSize {
+				if _, err := bm.Pin(file.NewBlockID("testfile", 100+i)); err != nil {
+					t.Fatalf("bm.Pin(%d): %v", 100+i, err)
+				}
+			}
+			if _, err := bm.Pin(file.NewBlockID("testfile", 200)); !errors.Is(err, buffer.ErrBufferAbort) {
+				t.Errorf("bm.Pin with all buffers pinned: got %v, want ErrBufferAbort", err)
+			}
+		})
+	}
+}
+
+func BenchmarkBufferManagerPin(b *testing.B) {
+	for _, buffSize := range []int32{100, 1000, 10000, 100000} {
+		db, err := server.NewSimpleDB(path.Join(b.TempDir(), "pinbench"), 400, 3)
+		if err != nil {
+			b.Fatalf("NewSimpleDB: %v", err)
+		}
+		bm := buffer.NewManager(db.FileManager, db.LogManager, buffSize)
+		for i := range buffSize {
+			buf, err := bm.Pin(file.NewBlockID("testfile", i))
+			if err != nil {
+				b.Fatalf("bm.Pin(%d): %v", i, err)
+			}
+			bm.Unpin(buf)
+		}
+
+		b.Run(fmt.Sprintf("hit/buffers=%d", buffSize), func(b *testing.B) {
+			for i := range b.N {
+				buf, err := bm.Pin(file.NewBlockID("testfile", int32(i)%buffSize))
+				if err != nil {
+					b.Fatalf("bm.Pin: %v", err)
+				}
+				bm.Unpin(buf)
+			}
+		})
+		b.Run(fmt.Sprintf("miss/buffers=%d", buffSize), func(b *testing.B) {
+			// every block is beyond the ones in the pool, so each pin replaces a buffer
+			for i := range b.N {
+				buf, err := bm.Pin(file.NewBlockID("testfile", buffSize+int32(i)))
+				if err != nil {
+					b.Fatalf("bm.Pin: %v", err)
+				}
+				bm.Unpin(buf)
+			}
+		})
+	}
+}
+
+func TestBufferManagerBackgroundWriter(t *testing.T) {
+	t.Parallel()
+
+	dbDir := path.Join(t.TempDir(), "writertest")
+	db, err := server.NewSimpleDB(dbDir, 400, 3,
+		server.WithBufferOptions(buffer.WithBackgroundWriter(10*time.Millisecond, 2)))
+	if err != nil {
+		t.Fatalf("NewSimpleDB: %v", err)
+	}
+
+	// modify 3 blocks without committing, so only the background writer writes them
+	tx := db.NewTx()
+	for i := range int32(3) {
+		blk := file.NewBlockID("testfile", i)
+		if err := tx.Pin(blk); err != nil {
+			t.Fatalf("tx.Pin: %v", err)
+		}
+		if err := tx.SetInt(blk, 80, 100+i, true); err != nil {
+			t.Fatalf("tx.SetInt: %v", err)
+		}
+	}
+	for i := range int32(3) {
+		if err := tx.Unpin(file.NewBlockID("testfile", i)); err != nil {
+			t.Fatalf("tx.Unpin: %v", err)
+		}
+	}
+	// at most 2 pages are written in a round, so all of them are written after 2 rounds
+	time.Sleep(200 * time.Millisecond)
+	if err := db.Close(); err != nil {
+		t.Fatalf("db.Close: %v", err)
+	}
+
+	p := file.NewPage(400)
+	for i := range int32(3) {
+		if err := db.FileManager.Load(file.NewBlockID("testfile", i), p); err != nil {
+			t.Fatalf("fm.Load: %v", err)
+		}
+		if got := p.GetInt(80); got != 100+i {
+			t.Errorf("block %d: value on disk=%d, want %d", i, got, 100+i)
+		}
+	}
+
+	// the log records of the modifications were written before the pages, so recovery undoes them
+	db, err = server.NewSimpleDB(dbDir, 400, 3)
+	if err != nil {
+		t.Fatalf("NewSimpleDB: %v", err)
+	}
+	if err := db.NewTx().Recover(); err != nil {
+		t.Fatalf("tx.Recover: %v", err)
+	}
+	for i := range int32(3) {
+		if err := db.FileManager.Load(file.NewBlockID("testfile", i), p); err != nil {
+			t.Fatalf("fm.Load: %v", err)
+		}
+		if got := p.GetInt(80); got != 0 {
+			t.Errorf("block %d: value on disk after recovery=%d, want 0", i, got)
+		}
+	}
+}
+
+// writeBlocks writes n blocks to the file, each holding its index at offset 0.
+func writeBlocks(tb testing.TB, fm *file.Manager, filename string, n int32) {
+	tb.Helper()
+	p := file.NewPage(fm.BlockSize)
+	for i := range n {
+		p.SetInt(0, i)
+		if err := fm.Save(file.NewBlockID(filename, i), p); err != nil {
+			tb.Fatalf("fm.Save: %v", err)
+		}
+	}
+}
+
+func TestBufferManagerPrefetch(t *testing.T) {
+	t.Parallel()
+
+	db, err := server.NewSimpleDB(path.Join(t.TempDir(), "prefetchtest"), 400, 3)
+	if err != nil {
+		t.Fatalf("NewSimpleDB: %v", err)
+	}
+	writeBlocks(t, db.FileManager, "testfile", 10)
+	bm := buffer.NewManager(db.FileManager, db.LogManager, 8)
+
+	var blocks []file.BlockID
+	for _, i := range []int32{2, 3, 4, 7, 20} { // block 20 is beyond the end of the file
+		blocks = append(blocks, file.NewBlockID("testfile", i))
+	}
+	bm.Prefetch(blocks)
+	waitForPrefetches(t, bm, 4)
+
+	for _, blk := range blocks[:4] {
+		buf, err := bm.Pin(blk)
+		if err != nil {
+			t.Fatalf("bm.Pin: %v", err)
+		}
+		if got := buf.Contents.GetInt(0); got != blk.Index {
+			t.Errorf("block %d holds %d", blk.Index, got)
+		}
+		bm.Unpin(buf)
+	}
+	if s := bm.Stats(); s.PrefetchHits != 4 || s.Hits != 0 || s.Misses != 0 {
+		t.Errorf("prefetch hits=%d, hits=%d, misses=%d, want 4, 0 and 0", s.PrefetchHits, s.Hits, s.Misses)
+	}
+	if n := bm.NumAvailable(); n != 8 {
+		t.Errorf("bm.NumAvailable()=%d, want 8", n)
+	}
+	if err := bm.Close(); err != nil {
+		t.Fatalf("bm.Close: %v", err)
+	}
+}
+
+// waitForPrefetches waits until n blocks have been read ahead and no buffer is pinned.
+func waitForPrefetches(tb testing.TB, bm *buffer.Manager, n int64) {
+	tb.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		s := bm.Stats()
+		if s.Prefetches >= n && s.Available == s.Buffers {
+			return
+		}
+		if time.Now().After(deadline) {
+			tb.Fatalf("prefetches=%d, available=%d after 5s, want %d and %d", s.Prefetches, s.Available, n, s.Buffers)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestBufferManagerReadAhead(t *testing.T) {
+	t.Parallel()
+
+	db, err := server.NewSimpleDB(path.Join(t.TempDir(), "readaheadtest"), 400, 3)
+	if err != nil {
+		t.Fatalf("NewSimpleDB: %v", err)
+	}
+	writeBlocks(t, db.FileManager, "testfile", 100)
+	bm := buffer.NewManager(db.FileManager, db.LogManager, 16, buffer.WithReadAhead(8))
+
+	scan := func(from, to int32) {
+		for i := from; i < to; i++ {
+			buf, err := bm.Pin(file.NewBlockID("testfile", i))
+			if err != nil {
+				t.Fatalf("bm.Pin(%d): %v", i, err)
+			}
+			buf.RLock()
+			if got := buf.Contents.GetInt(0); got != i {
+				t.Errorf("block %d holds %d", i, got)
+			}
+			buf.RUnlock()
+			bm.Unpin(buf)
+		}
+	}
+
+	// the third consecutive block starts reading the next 8 blocks ahead,
+	// and pinning them waits for the prefetch if needed
+	scan(0, 3)
+	scan(3, 11)
+	if s := bm.Stats(); s.PrefetchHits != 8 || s.Hits != 0 || s.Misses != 3 {
+		t.Errorf("prefetch hits=%d, hits=%d, misses=%d, want 8, 0 and 3", s.PrefetchHits, s.Hits, s.Misses)
+	}
+
+	// the rest of the scan races with the prefetches
+	scan(11, 100)
+	waitForPrefetches(t, bm, 0)
+	if err := bm.Close(); err != nil {
+		t.Fatalf("bm.Close: %v", err)
+	}
+}
+
+func TestBufferManagerPinDuringPrefetch(t *testing.T) {
+	t.Parallel()
+
+	db, err := server.NewSimpleDB(path.Join(t.TempDir(), "pinprefetchtest"), 400, 3)
+	if err != nil {
+		t.Fatalf("NewSimpleDB: %v", err)
+	}
+	writeBlocks(t, db.FileManager, "testfile", 4)
+	bm := buffer.NewManager(db.FileManager, db.LogManager, 2)
+
+	// the unpinned buffer is latched, and replaced by the prefetch
+	latched, err := bm.Pin(file.NewBlockID("testfile", 0))
+	if err != nil {
+		t.Fatalf("bm.Pin: %v", err)
+	}
+	latched.Lock()
+	bm.Unpin(latched)
+	blk1 := file.NewBlockID("testfile", 1)
+	buff, err := bm.Pin(blk1)
+	if err != nil {
+		t.Fatalf("bm.Pin: %v", err)
+	}
+	bm.Prefetch([]file.BlockID{file.NewBlockID("testfile", 3)})
+
+	// the block in the pool is pinned while the prefetch waits for the latch
+	pinned := make(chan error, 1)
+	go func() {
+		for bm.NumAvailable() > 0 {
+			time.Sleep(time.Millisecond)
+		}
+		buff, err := bm.Pin(blk1)
+		if err == nil {
+			bm.Unpin(buff)
+		}
+		pinned <- err
+	}()
+	select {
+	case err := <-pinned:
+		if err != nil {
+			t.Errorf("bm.Pin: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("bm.Pin of a block in the pool waited for the latch of a buffer read ahead")
+	}
+
+	latched.Unlock()
+	bm.Unpin(buff)
+	waitForPrefetches(t, bm, 1)
+	if err := bm.Close(); err != nil {
+		t.Fatalf("bm.Close: %v", err)
+	}
+}
+
+func TestReplacementPoliciesReadAhead(t *testing.T) {
+	t.Parallel()
+
+	db, err := server.NewSimpleDB(path.Join(t.TempDir(), "readaheadpolicytest"), 400, 3)
+	if err != nil {
+		t.Fatalf("NewSimpleDB: %v", err)
+	}
+	writeBlocks(t, db.FileManager, "testfile", 40)
+	bm := buffer.NewManager(db.FileManager, db.LogManager, 16,
+		buffer.WithReplacementPolicy(buffer.NewLRUKPolicy(2)), buffer.WithReadAhead(4))
+	pin := func(blk file.BlockID) {
+		t.Helper()
+		buf, err := bm.Pin(blk)
+		if err != nil {
+			t.Fatalf("bm.Pin(%v): %v", blk, err)
+		}
+		bm.Unpin(buf)
+	}
+
+	// the hot blocks are pinned twice, and the blocks read ahead by a scan are pinned once,
+	// so the scan does not replace the hot blocks
+	hot := []file.BlockID{file.NewBlockID("hotfile", 0), file.NewBlockID("hotfile", 1)}
+	for _, blk := range hot {
+		pin(blk)
+		pin(blk)
+	}
+	for i := range int32(40) {
+		pin(file.NewBlockID("testfile", i))
+	}
+	waitForPrefetches(t, bm, 0)
+	hits := bm.Hits()
+	for _, blk := range hot {
+		pin(blk)
+	}
+	if got := bm.Hits() - hits; got != 2 {
+		t.Errorf("hits of the hot blocks after the scan=%d, want 2", got)
+	}
+	if err := bm.Close(); err != nil {
+		t.Fatalf("bm.Close: %v", err)
+	}
+}
+
+func BenchmarkBufferManagerScan(b *testing.B) {
+	const numBlocks = 1000
+	for _, readAhead := range []int32{0, 8, 32} {
+		b.Run(fmt.Sprintf("readahead=%d", readAhead), func(b *testing.B) {
+			db, err := server.NewSimpleDB(path.Join(b.TempDir(), "scanbench"), 400, 3)
+			if err != nil {
+				b.Fatalf("NewSimpleDB: %v", err)
+			}
+			writeBlocks(b, db.FileManager, "testfile", numBlocks)
+			bm := buffer.NewManager(db.FileManager, db.LogManager, 64, buffer.WithReadAhead(readAhead))
+			defer bm.Close()
+
+			b.ResetTimer()
+			for range b.N {
+				for i := range int32(numBlocks) {
+					buf, err := bm.Pin(file.NewBlockID("testfile", i))
+					if err != nil {
+						b.Fatalf("bm.Pin(%d): %v", i, err)
+					}
+					buf.RLock()
+					_ = buf.Contents.GetInt(0)
+					buf.RUnlock()
+					bm.Unpin(buf)
+				}
+			}
+			s := bm.Stats()
+			b.ReportMetric(float64(s.Hits+s.PrefetchHits)/float64(s.Hits+s.PrefetchHits+s.Misses), "hits/pin")
+		})
+	}
+}
+
+func TestBufferManagerStats(t *testing.T) {
+	t.Parallel()
+
+	db, err := server.NewSimpleDB(path.Join(t.TempDir(), "statstest"), 400, 3)
+	if err != nil {
+		t.Fatalf("NewSimpleDB: %v", err)
+	}
+	bm := buffer.NewManager(db.FileManager, db.LogManager, 2, buffer.WithMaxWaitTime(10*time.Millisecond))
+
+	buf0, err := bm.Pin(file.NewBlockID("testfile", 0))
+	if err != nil {
+		t.Fatalf("bm.Pin: %v", err)
+	}
+	buf0.Lock()
+	buf0.Contents.SetInt(0, 1)
+	buf0.SetModified(7, 3)
+	buf0.Unlock()
+	if _, err := bm.Pin(file.NewBlockID("testfile", 0)); err != nil { // hit
+		t.Fatalf("bm.Pin: %v", err)
+	}
+	buf1, err := bm.Pin(file.NewBlockID("testfile", 1))
+	if err != nil {
+		t.Fatalf("bm.Pin: %v", err)
+	}
+	// all buffers are pinned
+	if _, err := bm.Pin(file.NewBlockID("testfile", 2)); !errors.Is(err, buffer.ErrBufferAbort) {
+		t.Fatalf("bm.Pin: got %v, want ErrBufferAbort", err)
+	}
+
+	want := buffer.Stats{Buffers: 2, Available: 0, Dirty: 1, Hits: 1, Misses: 2, PinWaits: 1, PinAborts: 1}
+	if got := bm.Stats(); got != want {
+		t.Errorf("bm.Stats()=%+v, want %+v", got, want)
+	}
+	if got := bm.Stats().HitRatio(); got != 1.0/3 {
+		t.Errorf("HitRatio()=%v, want 1/3", got)
+	}
+
+	// the pinned buffers show which blocks are leaked
+	infos := bm.Buffers()
+	slices.SortFunc(infos, func(a, b buffer.BufferInfo) int { return int(a.Block.Index - b.Block.Index) })
+	wantInfos := []buffer.BufferInfo{
+		{Block: file.NewBlockID("testfile", 0), Pins: 2, TxNum: 7, LSN: 3, Dirty: true},
+		{Block: file.NewBlockID("testfile", 1), Pins: 1, TxNum: -1},
+	}
+	if !slices.Equal(infos, wantInfos) {
+		t.Errorf("bm.Buffers()=%+v, want %+v", infos, wantInfos)
+	}
+
+	// a buffer latched by its writer, e.g. during a disk write, delays neither the snapshots nor the pins
+	buf1.Lock()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		bm.Stats()
+		bm.Buffers()
+		if buf, err := bm.Pin(file.NewBlockID("testfile", 0)); err == nil {
+			bm.Unpin(buf)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Errorf("bm.Stats and bm.Buffers waited for the latch of a buffer")
+	}
+	buf1.Unlock()
+
+	// replacing the modified block writes it
+	bm.Unpin(buf1)
+	bm.Unpin(buf0)
+	bm.Unpin(buf0)
+	for _, i := range []int32{2, 3} {
+		buf, err := bm.Pin(file.NewBlockID("testfile", i))
+		if err != nil {
+			t.Fatalf("bm.Pin: %v", err)
+		}
+		bm.Unpin(buf)
+	}
+	s := bm.Stats()
+	if s.Dirty != 0 || s.Evictions != 2 || s.Available != 2 {
+		t.Errorf("bm.Stats()=%+v, want Dirty=0, Evictions=2, Available=2", s)
+	}
+}
+
+func TestBufferManagerPinOwners(t *testing.T) {
+	t.Parallel()
+
+	db, err := server.NewSimpleDB(path.Join(t.TempDir(), "ownertest"), 400, 3)
+	if err != nil {
+		t.Fatalf("NewSimpleDB: %v", err)
+	}
+	var reported []file.BlockID
+	bm := buffer.NewManager(db.FileManager, db.LogManager, 3,
+		buffer.WithMaxPinsPerTx(1),
+		buffer.WithPinLeakHandler(func(txNum int32, blocks []file.BlockID) {
+			if txNum != 1 {
+				t.Errorf("leak reported for tx %d, want 1", txNum)
+			}
+			reported = blocks
+		}))
+	ctx := context.Background()
+	blk0 := file.NewBlockID("testfile", 0)
+
+	buf, err := bm.PinFor(ctx, 1, blk0)
+	if err != nil {
+		t.Fatalf("bm.PinFor: %v", err)
+	}
+	if _, err := bm.PinFor(ctx, 1, blk0); err != nil {
+		t.Fatalf("bm.PinFor of a held buffer: %v", err)
+	}
+	var limitErr *buffer.PinLimitError
+	if _, err := bm.PinFor(ctx, 1, file.NewBlockID("testfile", 1)); !errors.As(err, &limitErr) || limitErr.TxNum != 1 {
+		t.Fatalf("bm.PinFor beyond the limit: got %v, want PinLimitError", err)
+	}
+	if err := bm.UnpinFor(2, buf); !errors.Is(err, buffer.ErrNotPinned) {
+		t.Errorf("bm.UnpinFor by another tx: got %v, want ErrNotPinned", err)
+	}
+	if err := bm.UnpinFor(1, buf); err != nil {
+		t.Fatalf("bm.UnpinFor: %v", err)
+	}
+
+	if leaked := bm.ReleasePins(1); !slices.Equal(leaked, []file.BlockID{blk0}) || !slices.Equal(reported, leaked) {
+		t.Errorf("bm.ReleasePins=%v, reported %v, want [%v]", leaked, reported, blk0)
+	}
+	if leaked := bm.ReleasePins(1); leaked != nil {
+		t.Errorf("bm.ReleasePins again=%v, want none", leaked)
+	}
+	if n := bm.NumAvailable(); n != 3 {
+		t.Errorf("bm.NumAvailable()=%d, want 3", n)
+	}
+}
@@ -0,0 +1,109 @@
+package buffer
+
+import (
+	"cmp"
+	"context"
+	"ddai-go/file"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// ErrNotPinned is returned when a transaction unpins or accesses a buffer it does not hold.
+var ErrNotPinned = errors.New("buffer is not pinned by the transaction")
+
+// PinLimitError is returned when a transaction tries to pin more buffers than allowed by WithMaxPinsPerTx.
+type PinLimitError struct {
+	TxNum int32
+	Limit int
+}
+
+func (e *PinLimitError) Error() string {
+	return fmt.Sprintf("transaction %d cannot pin more than %d buffers", e.TxNum, e.Limit)
+}
+
+// WithMaxPinsPerTx limits how many buffers a transaction can pin at once through PinFor,
+// so that a single transaction cannot pin the whole pool. Pinning a buffer it already holds is not limited.
+func WithMaxPinsPerTx(n int) Option {
+	return func(bm *Manager) {
+		bm.maxPinsPerTx = n
+	}
+}
+
+// WithPinLeakHandler sets the function called by ReleasePins with the blocks still pinned by the finishing transaction.
+// A block pinned several times appears as many times. By default, the leaked pins are only returned by ReleasePins.
+func WithPinLeakHandler(f func(txNum int32, blocks []file.BlockID)) Option {
+	return func(bm *Manager) {
+		bm.leakHandler = f
+	}
+}
+
+// PinFor is like PinContext, but records that the pin is held by the transaction.
+// It returns a *PinLimitError if the transaction would hold more buffers than allowed.
+func (bm *Manager) PinFor(ctx context.Context, txNum int32, blk file.BlockID) (*Buffer, error) {
+	bm.cond.L.Lock()
+	defer bm.cond.L.Unlock()
+
+	pins := bm.owners[txNum]
+	if bm.maxPinsPerTx > 0 && len(pins) >= bm.maxPinsPerTx {
+		if buf, ok := bm.resident[blk]; !ok || pins[buf] == 0 {
+			return nil, &PinLimitError{TxNum: txNum, Limit: bm.maxPinsPerTx}
+		}
+	}
+	buf, err := bm.pin(ctx, blk)
+	if err != nil {
+		return nil, err
+	}
+	if pins == nil {
+		pins = make(map[*Buffer]int32)
+		bm.owners[txNum] = pins
+	}
+	pins[buf]++
+	return buf, nil
+}
+
+// UnpinFor releases a pin of the buffer held by the transaction, and returns ErrNotPinned if it holds none.
+func (bm *Manager) UnpinFor(txNum int32, buf *Buffer) error {
+	bm.cond.L.Lock()
+	defer bm.cond.L.Unlock()
+
+	pins := bm.owners[txNum]
+	if pins[buf] == 0 {
+		return fmt.Errorf("%v: %w", buf.Block, ErrNotPinned)
+	}
+	bm.unpin(buf)
+	if pins[buf]--; pins[buf] == 0 {
+		delete(pins, buf)
+	}
+	if len(pins) == 0 {
+		delete(bm.owners, txNum)
+	}
+	return nil
+}
+
+// ReleasePins releases all the pins still held by the finishing transaction, and returns their blocks,
+// which are reported to the leak handler since the transaction should have unpinned them.
+func (bm *Manager) ReleasePins(txNum int32) []file.BlockID {
+	bm.cond.L.Lock()
+	var leaked []file.BlockID
+	for buf, n := range bm.owners[txNum] {
+		for range n {
+			leaked = append(leaked, buf.Block)
+			bm.unpin(buf)
+		}
+	}
+	delete(bm.owners, txNum)
+	bm.cond.L.Unlock()
+
+	if len(leaked) == 0 {
+		return nil
+	}
+	slices.SortFunc(leaked, func(a, b file.BlockID) int {
+		return cmp.Or(cmp.Compare(a.FileName, b.FileName), cmp.Compare(a.Index, b.Index))
+	})
+	// called without the pool latch, so that the handler may use the Manager
+	if bm.leakHandler != nil {
+		bm.leakHandler(txNum, leaked)
+	}
+	return leaked
+}
@@ -0,0 +1,202 @@
+package buffer
+
+import (
+	"cmp"
+	"ddai-go/file"
+	"slices"
+)
+
+// sequentialThreshold is how many consecutive blocks of a file must be pinned in order to start reading ahead.
+const sequentialThreshold = 3
+
+// sequence is the sequential access to a file.
+type sequence struct {
+	last       int32 // the index of the last pinned block
+	run        int32 // how many consecutive blocks were pinned up to last
+	prefetched int32 // the blocks up to this index have been prefetched
+}
+
+// WithReadAhead makes the Manager prefetch the next n blocks of a file when its blocks are pinned sequentially.
+func WithReadAhead(n int32) Option {
+	return func(bm *Manager) {
+		bm.readAhead = n
+	}
+}
+
+// detectSequentialAccess starts prefetching the blocks following blk if the file is accessed sequentially.
+// Prefetching starts when half of the previously prefetched blocks are pinned, so that each read covers several blocks.
+// The caller must hold the pool latch.
+func (bm *Manager) detectSequentialAccess(blk file.BlockID) {
+	if bm.readAhead <= 0 {
+		return
+	}
+	seq, ok := bm.sequences[blk.FileName]
+	switch {
+	case ok && blk.Index == seq.last:
+		return
+	case ok && blk.Index == seq.last+1:
+		seq.run++
+	default:
+		seq = sequence{run: 1, prefetched: blk.Index}
+	}
+	seq.last = blk.Index
+	if seq.run >= sequentialThreshold && blk.Index+bm.readAhead/2 >= seq.prefetched {
+		from := max(blk.Index, seq.prefetched) + 1
+		to := blk.Index + bm.readAhead
+		blocks := make([]file.BlockID, 0, to-from+1)
+		for i := from; i <= to; i++ {
+			blocks = append(blocks, file.NewBlockID(blk.FileName, i))
+		}
+		seq.prefetched = to
+		// the buffers are reserved right away, since the pool latch is rarely free during a scan
+		if rs := bm.reserveBuffers(blocks); len(rs) > 0 {
+			bm.wg.Add(1)
+			go func() {
+				defer bm.wg.Done()
+				bm.load(rs)
+			}()
+		}
+	}
+	bm.sequences[blk.FileName] = seq
+}
+
+// Prefetch reads the blocks into unpinned buffers in the background, so that pinning them later needs no disk access.
+// Blocks beyond the end of their file are ignored, and so are the remaining blocks once no unpinned buffer is left;
+// prefetching never writes a modified buffer to disk, nor waits for a buffer to be released.
+func (bm *Manager) Prefetch(blocks []file.BlockID) {
+	blocks = slices.Clone(blocks)
+	bm.wg.Add(1)
+	go func() {
+		defer bm.wg.Done()
+
+		bm.cond.L.Lock()
+		rs := bm.reserveBuffers(blocks)
+		bm.cond.L.Unlock()
+		bm.load(rs)
+	}()
+}
+
+// reservation is a buffer reserved to read a block ahead, and the block it held before.
+type reservation struct {
+	buf *Buffer
+	old file.BlockID
+	blk file.BlockID
+}
+
+// reserveBuffers reserves unpinned buffers for the blocks that are not in the pool.
+// A reserved buffer is pinned and loading until load releases it,
+// so that neither the Manager nor the pins of its old and new blocks use it meanwhile.
+// It neither accesses the disk nor waits for the latches of the buffers, which are left to load.
+// The caller must hold the pool latch.
+func (bm *Manager) reserveBuffers(blocks []file.BlockID) []reservation {
+	var rs []reservation
+	for _, blk := range blocks {
+		if _, ok := bm.resident[blk]; ok {
+			continue
+		}
+		buf := bm.chooseUnpinnedBuffer()
+		if buf == nil {
+			break
+		}
+		rs = append(rs, reservation{buf: buf, old: buf.Block, blk: blk})
+		buf.loading = true
+		buf.prefetched = false
+		bm.resident[blk] = buf
+		buf.Pin()
+		bm.numAvailable--
+	}
+	return rs
+}
+
+// load reads the blocks into the buffers reserved by reserveBuffers, and releases them.
+// Blocks beyond the end of their file are not read, and a buffer modified since it was unpinned keeps its block,
+// which is left to be written by its replacement, the background writer or the commit.
+// The caller must not hold the pool latch.
+func (bm *Manager) load(rs []reservation) {
+	if len(rs) == 0 {
+		return
+	}
+
+	lengths := make(map[string]int32)
+	var loading []reservation
+	for _, r := range rs {
+		if !bm.exists(r.blk, lengths) {
+			continue
+		}
+		r.buf.latch.Lock()
+		if r.buf.txNum.Load() > 0 {
+			r.buf.latch.Unlock()
+			continue
+		}
+		loading = append(loading, r)
+	}
+
+	// read each run of consecutive blocks at once
+	slices.SortFunc(loading, func(a, b reservation) int {
+		return cmp.Or(cmp.Compare(a.blk.FileName, b.blk.FileName), cmp.Compare(a.blk.Index, b.blk.Index))
+	})
+	read := make(map[*Buffer]bool)
+	for start := 0; start < len(loading); {
+		first := loading[start].blk
+		end := start + 1
+		for end < len(loading) && loading[end].blk == file.NewBlockID(first.FileName, first.Index+int32(end-start)) {
+			end++
+		}
+		pages := make([]*file.Page, 0, end-start)
+		for _, r := range loading[start:end] {
+			pages = append(pages, r.buf.Contents)
+		}
+		// on failure, the blocks are read again by Pin, which reports the error
+		err := bm.fileManager.LoadBlocks(first, pages)
+		for _, r := range loading[start:end] {
+			read[r.buf] = err == nil
+		}
+		start = end
+	}
+
+	// the latches are released first, as the pool latch must not be acquired while holding them
+	for _, r := range loading {
+		r.buf.latch.Unlock()
+	}
+	bm.cond.L.Lock()
+	defer bm.cond.L.Unlock()
+	for _, r := range rs {
+		buf := r.buf
+		buf.loading = false
+		ok, tried := read[buf]
+		switch {
+		case !tried:
+			// the block does not exist, or the buffer was modified and still holds its old block
+			delete(bm.resident, r.blk)
+		case !ok:
+			delete(bm.resident, r.blk)
+			delete(bm.resident, r.old)
+			buf.Block = file.BlockID{}
+			bm.free = append(bm.free, buf)
+		default:
+			if r.old != (file.BlockID{}) {
+				delete(bm.resident, r.old)
+				bm.counters.evictions++
+			}
+			buf.Block = r.blk
+			buf.prefetched = true
+			bm.policy.Prefetched(buf)
+			bm.counters.prefetches++
+		}
+		bm.unpin(buf)
+	}
+}
+
+// exists reports whether the block is not beyond the end of its file.
+// The lengths of the files are cached in lengths, so that each file is looked up once.
+func (bm *Manager) exists(blk file.BlockID, lengths map[string]int32) bool {
+	n, ok := lengths[blk.FileName]
+	if !ok {
+		var err error
+		if n, err = bm.fileManager.Length(blk.FileName); err != nil {
+			n = 0
+		}
+		lengths[blk.FileName] = n
+	}
+	return blk.Index < n
+}
@@ -0,0 +1,49 @@
+package buffer
+
+// ReplacementPolicy chooses which unpinned buffer is replaced when a block that is not in the pool is pinned.
+// The Manager calls its methods while holding the pool latch, so implementations need no synchronization.
+type ReplacementPolicy interface {
+	// Init is called once with all buffers of the pool, which are unpinned and not assigned to any block.
+	Init(buffers []*Buffer)
+	// Pinned is called each time a buffer is pinned.
+	// hit is false for the first pin of the block since it was assigned to the buffer.
+	Pinned(buf *Buffer, hit bool)
+	// Prefetched is called when a buffer is assigned to a block read ahead.
+	// The block is not referenced until its first pin, so the policy must not count it as a use.
+	Prefetched(buf *Buffer)
+	// Unpinned is called when a buffer is no longer pinned by anyone,
+	// and when the replacement of a buffer returned by Victim failed.
+	Unpinned(buf *Buffer)
+	// Victim returns an unpinned buffer to replace, or nil if all buffers are pinned.
+	// The returned buffer is then either pinned, or passed to Unpinned if its replacement failed.
+	Victim() *Buffer
+}
+
+// naivePolicy replaces the last unpinned buffer of the pool.
+type naivePolicy struct {
+	buffers []*Buffer
+}
+
+// NewNaivePolicy returns the policy that replaces the last unpinned buffer of the pool, regardless of its usage.
+func NewNaivePolicy() ReplacementPolicy {
+	return &naivePolicy{}
+}
+
+func (p *naivePolicy) Init(buffers []*Buffer) {
+	p.buffers = buffers
+}
+
+func (p *naivePolicy) Pinned(*Buffer, bool) {}
+
+func (p *naivePolicy) Prefetched(*Buffer) {}
+
+func (p *naivePolicy) Unpinned(*Buffer) {}
+
+func (p *naivePolicy) Victim() *Buffer {
+	for i := len(p.buffers) - 1; i >= 0; i-- {
+		if !p.buffers[i].IsPinned() {
+			return p.buffers[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package buffer
+
+import (
+	"container/list"
+	"ddai-go/file"
+)
+
+// twoQPolicy is the full 2Q algorithm.
+// Blocks pinned for the first time go to the FIFO queue a1in, and when replaced from there,
+// their IDs are remembered in a1out. A block pinned again while remembered in a1out goes to the LRU queue am.
+// a1in is kept around a quarter of the pool, so blocks read once by a scan cannot push out the blocks in am.
+type twoQPolicy struct {
+	kin, kout int
+	free      map[*Buffer]bool // buffers not in any queue
+	a1in      *list.List       // front is the newest
+	am        *list.List       // front is the most recently pinned
+	a1out     *list.List       // IDs of the blocks recently replaced from a1in, front is the newest
+	elems     map[*Buffer]*list.Element
+	inAm      map[*Buffer]bool
+	ghosts    map[file.BlockID]*list.Element
+}
+
+// NewTwoQPolicy returns the 2Q policy.
+func NewTwoQPolicy() ReplacementPolicy {
+	return &twoQPolicy{
+		free:   make(map[*Buffer]bool),
+		a1in:   list.New(),
+		am:     list.New(),
+		a1out:  list.New(),
+		elems:  make(map[*Buffer]*list.Element),
+		inAm:   make(map[*Buffer]bool),
+		ghosts: make(map[file.BlockID]*list.Element),
+	}
+}
+
+func (p *twoQPolicy) Init(buffers []*Buffer) {
+	p.kin = max(len(buffers)/4, 1)
+	p.kout = max(len(buffers)/2, 1)
+	for _, buf := range buffers {
+		p.free[buf] = true
+	}
+}
+
+func (p *twoQPolicy) Pinned(buf *Buffer, hit bool) {
+	if hit {
+		if p.inAm[buf] {
+			p.am.MoveToFront(p.elems[buf])
+		}
+		return
+	}
+	delete(p.free, buf)
+	if e, ok := p.elems[buf]; ok {
+		// the block was read ahead into a1in, and this is its first pin
+		p.a1in.Remove(e)
+	}
+	if e, ok := p.ghosts[buf.Block]; ok {
+		p.a1out.Remove(e)
+		delete(p.ghosts, buf.Block)
+		p.elems[buf] = p.am.PushFront(buf)
+		p.inAm[buf] = true
+		return
+	}
+	p.elems[buf] = p.a1in.PushFront(buf)
+}
+
+// Prefetched puts the buffer in a1in without looking up a1out, which is left to its first pin.
+func (p *twoQPolicy) Prefetched(buf *Buffer) {
+	delete(p.free, buf)
+	p.elems[buf] = p.a1in.PushFront(buf)
+}
+
+func (p *twoQPolicy) Unpinned(buf *Buffer) {
+	if _, ok := p.elems[buf]; !ok {
+		// the replacement of the buffer failed
+		p.free[buf] = true
+	}
+}
+
+func (p *twoQPolicy) Victim() *Buffer {
+	for buf := range p.free {
+		if !buf.IsPinned() {
+			delete(p.free, buf)
+			return buf
+		}
+	}
+	first, second := p.am, p.a1in
+	if p.a1in.Len() > p.kin {
+		first, second = p.a1in, p.am
+	}
+	buf := p.oldestUnpinned(first)
+	if buf == nil {
+		buf = p.oldestUnpinned(second)
+	}
+	if buf == nil {
+		return nil
+	}
+	if p.inAm[buf] {
+		p.am.Remove(p.elems[buf])
+		delete(p.inAm, buf)
+	} else {
+		p.a1in.Remove(p.elems[buf])
+		p.remember(buf.Block)
+	}
+	delete(p.elems, buf)
+	return buf
+}
+
+func (p *twoQPolicy) oldestUnpinned(q *list.List) *Buffer {
+	for e := q.Back(); e != nil; e = e.Prev() {
+		if buf := e.Value.(*Buffer); !buf.IsPinned() {
+			return buf
+		}
+	}
+	return nil
+}
+
+func (p *twoQPolicy) remember(blk file.BlockID) {
+	p.ghosts[blk] = p.a1out.PushFront(blk)
+	if p.a1out.Len() > p.kout {
+		oldest := p.a1out.Remove(p.a1out.Back()).(file.BlockID)
+		delete(p.ghosts, oldest)
+	}
+}
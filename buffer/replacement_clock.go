@@ -0,0 +1,52 @@
+package buffer
+
+// clockPolicy is the second-chance algorithm:
+// the clock hand sweeps the pool, clearing the reference bit of each unpinned buffer,
+// and replaces the first unpinned buffer whose bit is already clear.
+type clockPolicy struct {
+	buffers    []*Buffer
+	index      map[*Buffer]int
+	referenced []bool
+	hand       int
+}
+
+// NewClockPolicy returns the policy that gives each recently pinned buffer a second chance before replacing it.
+func NewClockPolicy() ReplacementPolicy {
+	return &clockPolicy{}
+}
+
+func (p *clockPolicy) Init(buffers []*Buffer) {
+	p.buffers = buffers
+	p.index = make(map[*Buffer]int, len(buffers))
+	for i, buf := range buffers {
+		p.index[buf] = i
+	}
+	p.referenced = make([]bool, len(buffers))
+}
+
+func (p *clockPolicy) Pinned(buf *Buffer, _ bool) {
+	p.referenced[p.index[buf]] = true
+}
+
+func (p *clockPolicy) Prefetched(buf *Buffer) {
+	p.referenced[p.index[buf]] = false
+}
+
+func (p *clockPolicy) Unpinned(*Buffer) {}
+
+func (p *clockPolicy) Victim() *Buffer {
+	// two rounds are enough to clear every reference bit and come back
+	for range 2 * len(p.buffers) {
+		i := p.hand
+		p.hand = (p.hand + 1) % len(p.buffers)
+		if p.buffers[i].IsPinned() {
+			continue
+		}
+		if p.referenced[i] {
+			p.referenced[i] = false
+			continue
+		}
+		return p.buffers[i]
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package buffer
+
+import "container/list"
+
+// lruPolicy replaces the least recently used unpinned buffer.
+type lruPolicy struct {
+	unpinned *list.List // front is the most recently unpinned
+	elems    map[*Buffer]*list.Element
+}
+
+// NewLRUPolicy returns the policy that replaces the buffer that has been unpinned for the longest time.
+func NewLRUPolicy() ReplacementPolicy {
+	return &lruPolicy{
+		unpinned: list.New(),
+		elems:    make(map[*Buffer]*list.Element),
+	}
+}
+
+func (p *lruPolicy) Init(buffers []*Buffer) {
+	for _, buf := range buffers {
+		p.elems[buf] = p.unpinned.PushBack(buf)
+	}
+}
+
+func (p *lruPolicy) Pinned(buf *Buffer, _ bool) {
+	if e, ok := p.elems[buf]; ok {
+		p.unpinned.Remove(e)
+		delete(p.elems, buf)
+	}
+}
+
+func (p *lruPolicy) Prefetched(buf *Buffer) {
+	p.Pinned(buf, false)
+}
+
+func (p *lruPolicy) Unpinned(buf *Buffer) {
+	if _, ok := p.elems[buf]; !ok {
+		p.elems[buf] = p.unpinned.PushFront(buf)
+	}
+}
+
+// Victim skips the pinned buffers, which are those taken from the free list of the Manager
+// and still loading their first block.
+func (p *lruPolicy) Victim() *Buffer {
+	for e := p.unpinned.Back(); e != nil; e = e.Prev() {
+		buf := e.Value.(*Buffer)
+		if buf.IsPinned() {
+			continue
+		}
+		p.unpinned.Remove(e)
+		delete(p.elems, buf)
+		return buf
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package buffer
+
+// lruKPolicy replaces the unpinned buffer whose K-th most recent pin is the oldest.
+// Buffers pinned fewer than K times since their block was assigned are replaced first, in LRU order,
+// so that blocks read once by a scan do not push out frequently used blocks.
+type lruKPolicy struct {
+	k       int
+	clock   int64
+	buffers []*Buffer
+	history map[*Buffer][]int64 // times of the last K pins, most recent first
+	loaded  map[*Buffer]int64   // times the blocks read ahead and not pinned yet were loaded
+}
+
+// NewLRUKPolicy returns the LRU-K policy. K=2 is the usual choice.
+func NewLRUKPolicy(k int) ReplacementPolicy {
+	return &lruKPolicy{
+		k:       max(k, 1),
+		history: make(map[*Buffer][]int64),
+		loaded:  make(map[*Buffer]int64),
+	}
+}
+
+func (p *lruKPolicy) Init(buffers []*Buffer) {
+	p.buffers = buffers
+}
+
+func (p *lruKPolicy) Pinned(buf *Buffer, hit bool) {
+	p.clock++
+	delete(p.loaded, buf)
+	h := p.history[buf]
+	if !hit {
+		h = h[:0] // the history belongs to the previous block
+	}
+	h = append([]int64{p.clock}, h...)
+	if len(h) > p.k {
+		h = h[:p.k]
+	}
+	p.history[buf] = h
+}
+
+// Prefetched clears the history, and keeps the time of the load to order the buffer among those never pinned.
+func (p *lruKPolicy) Prefetched(buf *Buffer) {
+	p.clock++
+	delete(p.history, buf)
+	p.loaded[buf] = p.clock
+}
+
+func (p *lruKPolicy) Unpinned(*Buffer) {}
+
+func (p *lruKPolicy) Victim() *Buffer {
+	var victim *Buffer
+	victimFull := true // whether the victim has K pins in its history
+	victimTime := int64(0)
+	for _, buf := range p.buffers {
+		if buf.IsPinned() {
+			continue
+		}
+		h := p.history[buf]
+		full := len(h) >= p.k
+		// with fewer than K pins, compare the most recent pin (LRU), otherwise the K-th most recent pin
+		t := int64(0)
+		if full {
+			t = h[p.k-1]
+		} else if len(h) > 0 {
+			t = h[0]
+		} else {
+			t = p.loaded[buf]
+		}
+		if victim == nil || (victimFull && !full) || (victimFull == full && t < victimTime) {
+			victim, victimFull, victimTime = buf, full, t
+		}
+	}
+	return victim
+}
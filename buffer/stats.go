@@ -0,0 +1,93 @@
+package buffer
+
+import "ddai-go/file"
+
+// counters are the activity of a Manager, guarded by the pool latch.
+type counters struct {
+	hits         int64
+	misses       int64
+	evictions    int64
+	prefetches   int64
+	prefetchHits int64
+	pinWaits     int64
+	pinAborts    int64
+}
+
+// Stats is a snapshot of the buffer pool.
+type Stats struct {
+	Buffers      int64 // the number of buffers in the pool
+	Available    int64 // the number of unpinned buffers
+	Dirty        int64 // the number of buffers modified and not yet written to disk
+	Hits         int64 // pins of blocks already in the pool, except the first pins of the blocks read ahead
+	Misses       int64 // pins of blocks read into a buffer
+	Evictions    int64 // blocks replaced by another block, by a pin or a prefetch
+	Prefetches   int64 // blocks read ahead into the pool
+	PrefetchHits int64 // first pins of the blocks read ahead
+	PinWaits     int64 // pins that had to wait for a buffer to be released
+	PinAborts    int64 // pins that gave up waiting with ErrBufferAbort
+}
+
+// HitRatio returns the ratio of the pins that found their block in the pool without reading it ahead,
+// or 0 if nothing was pinned.
+func (s Stats) HitRatio() float64 {
+	pins := s.Hits + s.Misses + s.PrefetchHits
+	if pins == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(pins)
+}
+
+// BufferInfo is a snapshot of a buffer.
+type BufferInfo struct {
+	Block file.BlockID // zero if the buffer has never been assigned to a block
+	Pins  int32
+	TxNum int32 // the transaction that modified the buffer, or -1 if not modified
+	LSN   int32 // the LSN of the latest modification
+	Dirty bool  // modified and not yet written to disk
+}
+
+// Stats returns a snapshot of the buffer pool.
+// It waits for neither the buffers being read or written nor the pins, but holds the pool latch
+// while copying the counters, so it is meant for monitoring rather than for frequent calls.
+func (bm *Manager) Stats() Stats {
+	bm.cond.L.Lock()
+	s := Stats{
+		Buffers:      int64(len(bm.bufferPool)),
+		Available:    int64(bm.numAvailable),
+		Hits:         bm.counters.hits,
+		Misses:       bm.counters.misses,
+		Evictions:    bm.counters.evictions,
+		Prefetches:   bm.counters.prefetches,
+		PrefetchHits: bm.counters.prefetchHits,
+		PinWaits:     bm.counters.pinWaits,
+		PinAborts:    bm.counters.pinAborts,
+	}
+	bm.cond.L.Unlock()
+
+	for _, buf := range bm.bufferPool {
+		if buf.txNum.Load() > 0 {
+			s.Dirty++
+		}
+	}
+	return s
+}
+
+// Buffers returns a snapshot of each buffer in the pool, e.g. to find the blocks left pinned.
+// The blocks and the pins are copied under the pool latch, and the modifications are read afterwards,
+// so the modification reported for a buffer replaced meanwhile may belong to its new block.
+func (bm *Manager) Buffers() []BufferInfo {
+	infos := make([]BufferInfo, len(bm.bufferPool))
+	bm.cond.L.Lock()
+	for i, buf := range bm.bufferPool {
+		infos[i].Block = buf.Block
+		infos[i].Pins = buf.pins
+	}
+	bm.cond.L.Unlock()
+
+	for i, buf := range bm.bufferPool {
+		infos[i].TxNum = buf.txNum.Load()
+		infos[i].LSN = buf.lsn.Load()
+		infos[i].Dirty = infos[i].TxNum > 0
+	}
+	return infos
+}
@@ -0,0 +1,65 @@
+// Rotatekey encrypts an encrypted database with a new key.
+//
+// The database must not be in use, and its format is read from its control file.
+// The keys are read from files holding them in hexadecimal:
+//
+//	rotatekey -dir db -old-key old.key -new-key new.key
+//
+// An interrupted rotation is completed by running the command again with the same keys.
+// The blocks are written to the journal simpledb.rotation in the directory before being rewritten in place,
+// so that the blocks torn by a crash are restored when the rotation is resumed.
+// The new key must differ from the current one.
+package main
+
+import (
+	"ddai-go/file"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+func main() {
+	dir := flag.String("dir", "", "the directory of the database")
+	oldKeyFile := flag.String("old-key", "", "the file holding the current key")
+	newKeyFile := flag.String("new-key", "", "the file holding the new key")
+	flag.Parse()
+	if *dir == "" || *oldKeyFile == "" || *newKeyFile == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(*dir, *oldKeyFile, *newKeyFile); err != nil {
+		fmt.Fprintf(os.Stderr, "rotatekey: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(dir string, oldKeyFile, newKeyFile string) error {
+	oldKey, err := readKey(oldKeyFile)
+	if err != nil {
+		return err
+	}
+	newKey, err := readKey(newKeyFile)
+	if err != nil {
+		return err
+	}
+	if err := file.RotateKey(dir, oldKey, newKey); err != nil {
+		return fmt.Errorf("file.RotateKey: %w", err)
+	}
+	fmt.Printf("%s: key %v replaced by key %v\n", dir, file.KeyIDOf(oldKey), file.KeyIDOf(newKey))
+	return nil
+}
+
+func readKey(name string) ([]byte, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("os.ReadFile: %w", err)
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(b)))
+	if err != nil {
+		return nil, fmt.Errorf("key in %s: %w", name, err)
+	}
+	return key, nil
+}
@@ -0,0 +1,137 @@
+package file
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+)
+
+// trailerSize is the size of the checksum stored after each block on disk.
+const trailerSize = 4
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// ErrCorruptBlock is matched by every CorruptBlockError.
+var ErrCorruptBlock = errors.New("corrupt block")
+
+// CorruptBlockError is returned when a block on disk does not match its checksum.
+type CorruptBlockError struct {
+	Block  BlockID
+	Reason string
+}
+
+func (e *CorruptBlockError) Error() string {
+	return fmt.Sprintf("corrupt block %v: %s", e.Block, e.Reason)
+}
+
+func (e *CorruptBlockError) Is(target error) bool {
+	return target == ErrCorruptBlock
+}
+
+// WithChecksums stores a CRC32C checksum after each block on disk, and verifies it when the block is read.
+// The pages keep BlockSize bytes; the checksum is not visible to the callers.
+// A database must always be opened with the same setting, since the blocks on disk are larger with checksums.
+func WithChecksums() Option {
+	return func(fm *Manager) {
+		fm.checksums = true
+	}
+}
+
+// diskBlockSize returns the size of a block on disk.
+func (fm *Manager) diskBlockSize() int {
+	size := int(fm.BlockSize)
+	if fm.aead != nil {
+		size += encryptionOverhead
+	}
+	if fm.checksums {
+		size += trailerSize
+	}
+	return size
+}
+
+// encode returns the bytes of the page to be written on disk for the block.
+// The page is encrypted first, so that the checksum covers the bytes on disk.
+func (fm *Manager) encode(blk BlockID, page []byte) []byte {
+	b := page
+	if fm.aead != nil {
+		b = fm.encrypt(blk, page)
+	}
+	if !fm.checksums {
+		return b
+	}
+	return binary.LittleEndian.AppendUint32(append(make([]byte, 0, fm.diskBlockSize()), b...), crc32.Checksum(b, castagnoli))
+}
+
+// decode verifies the bytes read from disk for the block, and copies its contents to the page.
+// The bytes are shorter than a block if the block is beyond the end of the file;
+// without checksums nor encryption, the missing part reads as zeros.
+// With them, the blocks in the file are always verified, since a gap before a written block is filled with empty blocks.
+func (fm *Manager) decode(blk BlockID, b []byte, page []byte) error {
+	if !fm.checksums && fm.aead == nil {
+		n := copy(page, b)
+		clear(page[n:])
+		return nil
+	}
+	switch {
+	case len(b) == 0: // beyond the end of the file
+		clear(page)
+		return nil
+	case len(b) < fm.diskBlockSize():
+		return &CorruptBlockError{Block: blk, Reason: "partially written"}
+	}
+	if fm.checksums {
+		data, trailer := b[:len(b)-trailerSize], b[len(b)-trailerSize:]
+		if crc32.Checksum(data, castagnoli) != binary.LittleEndian.Uint32(trailer) {
+			return &CorruptBlockError{Block: blk, Reason: "checksum mismatch"}
+		}
+		b = data
+	}
+	if fm.aead != nil {
+		return fm.decrypt(blk, b, page)
+	}
+	copy(page, b)
+	return nil
+}
+
+// Scrub reads every block of every file in DbDir except the control file, and returns the corrupt ones.
+// It requires checksums or encryption, and returns an error at the first failure other than a corrupt block.
+func (fm *Manager) Scrub() ([]*CorruptBlockError, error) {
+	if !fm.checksums && fm.aead == nil {
+		return nil, errors.New("scrub requires checksums or encryption")
+	}
+	names, err := fm.vfs.ReadDir(fm.DbDir)
+	if err != nil {
+		return nil, fmt.Errorf("vfs.ReadDir: %w", err)
+	}
+
+	var corrupt []*CorruptBlockError
+	p := NewPage(fm.BlockSize)
+	for _, name := range names {
+		if name == ControlFile {
+			continue
+		}
+		f, err := fm.open(name)
+		if err != nil {
+			return nil, fmt.Errorf("fm.open: %w", err)
+		}
+		fileSize, err := f.Size()
+		if err != nil {
+			return nil, fmt.Errorf("f.Size: %w", err)
+		}
+		// a partially written last block is counted too
+		size := int64(fm.diskBlockSize())
+		n := (fileSize + size - 1) / size
+		for i := range int32(n) {
+			err := fm.Load(NewBlockID(name, i), p)
+			var corruptErr *CorruptBlockError
+			switch {
+			case errors.As(err, &corruptErr):
+				corrupt = append(corrupt, corruptErr)
+			case err != nil:
+				return nil, fmt.Errorf("fm.Load: %w", err)
+			}
+		}
+	}
+	return corrupt, nil
+}
@@ -0,0 +1,318 @@
+package file
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"path"
+	"strconv"
+	"time"
+)
+
+// ControlFile is the name of the file in DbDir recording the format of the database.
+// It is not a file of blocks, so it is not read through the Manager.
+const ControlFile = "simpledb.ctl"
+
+// FormatVersion is the version of the on-disk format written by this package.
+const FormatVersion uint32 = 1
+
+// controlMagic identifies a control file.
+const controlMagic = "SIMPLEDB"
+
+// the layout of the control file, in little endian:
+// magic (8 bytes), version, block size, flags (4 bytes each), creation time in unix nanoseconds (8 bytes),
+// KeyID and previous KeyID (8 bytes each), and the CRC32C of the preceding bytes (4 bytes).
+const (
+	controlVersionOffset   = 8
+	controlBlockSizeOffset = 12
+	controlFlagsOffset     = 16
+	controlCreatedAtOffset = 20
+	controlKeyIDOffset     = 28
+	controlPrevKeyIDOffset = 36
+	controlChecksumOffset  = 44
+	controlSize            = 48
+)
+
+const (
+	controlFlagChecksums uint32 = 1 << iota
+	controlFlagEncrypted
+)
+
+// ErrNotDatabase is returned when the control file of DbDir is not a valid control file.
+var ErrNotDatabase = errors.New("not a database")
+
+// ErrIncompatible is matched by every IncompatibleError.
+var ErrIncompatible = errors.New("incompatible database")
+
+// IncompatibleError is returned when a database is opened with settings different from the ones it was created with,
+// or when it was written by a newer version of the format.
+type IncompatibleError struct {
+	Setting   string
+	Stored    string
+	Requested string
+}
+
+func (e *IncompatibleError) Error() string {
+	return fmt.Sprintf("database was created with %s %s, but opened with %s", e.Setting, e.Stored, e.Requested)
+}
+
+func (e *IncompatibleError) Is(target error) bool {
+	return target == ErrIncompatible
+}
+
+// Control is the format of a database, recorded in its control file when it is created.
+type Control struct {
+	Version   uint32
+	BlockSize int32
+	Checksums bool
+	Encrypted bool
+	KeyID     KeyID // the key of the blocks, if Encrypted
+	PrevKeyID KeyID // the key replaced by KeyID, while the key is rotated
+	CreatedAt time.Time
+}
+
+// upgrades converts a database from a version of the format to the next one, e.g. upgrades[0] converts version 0 to 1.
+// An upgrade may rewrite the files of the database, and change the control, which is written once all the upgrades succeeded.
+// A new format version must add its upgrade here.
+var upgrades = map[uint32]func(fm *Manager, c *Control) error{
+	// version 0 is a database created before the control file existed, which records no format:
+	// it is given the format it is opened with, once its files are verified to be consistent with it.
+	0: func(fm *Manager, c *Control) error {
+		if err := fm.checkFormat(); err != nil {
+			return err
+		}
+		c.BlockSize = fm.BlockSize
+		c.Checksums = fm.checksums
+		return nil
+	},
+}
+
+// checkFormat verifies that the files in DbDir are made of blocks of the size on disk of the manager,
+// whose checksums are valid if the manager has checksums, for a database that does not record its format.
+// A file whose size is a multiple of both block sizes cannot tell them apart, so every file is checked.
+func (fm *Manager) checkFormat() error {
+	if fm.aead != nil {
+		return &IncompatibleError{Setting: "encryption", Stored: "false", Requested: "true"}
+	}
+	names, err := fm.vfs.ReadDir(fm.DbDir)
+	if err != nil {
+		return fmt.Errorf("vfs.ReadDir: %w", err)
+	}
+	for _, name := range names {
+		if isTempFile(name) {
+			continue // the temporary files do not belong to the database
+		}
+		if err := fm.checkFileFormat(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkFileFormat verifies the blocks of the file for checkFormat.
+// The file is not kept open, since the manager may not be used if the format is not the right one.
+func (fm *Manager) checkFileFormat(name string) error {
+	f, err := fm.vfs.OpenFile(path.Join(fm.DbDir, name))
+	if err != nil {
+		return fmt.Errorf("vfs.OpenFile: %w", err)
+	}
+	defer f.Close()
+
+	fileSize, err := f.Size()
+	if err != nil {
+		return fmt.Errorf("f.Size: %w", err)
+	}
+	size := int64(fm.diskBlockSize())
+	if fileSize%size != 0 {
+		return fmt.Errorf("%w: %s has %d bytes, which is not a whole number of blocks of %d bytes",
+			ErrIncompatible, name, fileSize, size)
+	}
+	if !fm.checksums {
+		return nil
+	}
+	b := make([]byte, size)
+	page := make([]byte, fm.BlockSize)
+	for i := range int32(fileSize / size) {
+		if _, err := f.ReadAt(b, int64(i)*size); err != nil {
+			return fmt.Errorf("f.ReadAt: %w", err)
+		}
+		if err := fm.decode(NewBlockID(name, i), b, page); err != nil {
+			return fmt.Errorf("%w: %w", ErrIncompatible, err)
+		}
+	}
+	return nil
+}
+
+// withStoredFormat makes the manager open an existing database with the block size and the checksums
+// recorded in its control file, instead of the ones it is given.
+func withStoredFormat() Option {
+	return func(fm *Manager) {
+		fm.stored = true
+	}
+}
+
+// Control returns the format of the database.
+func (fm *Manager) Control() Control {
+	return fm.control
+}
+
+// initControl writes the control file of a new database, or validates the one of an existing database and upgrades its format.
+func (fm *Manager) initControl(isNew bool) error {
+	if isNew {
+		fm.control = Control{
+			Version:   FormatVersion,
+			BlockSize: fm.BlockSize,
+			Checksums: fm.checksums,
+			Encrypted: fm.aead != nil,
+			CreatedAt: time.Now(),
+		}
+		if fm.aead != nil {
+			fm.control.KeyID = KeyIDOf(fm.key)
+		}
+		return fm.writeControl(true)
+	}
+
+	c, exists, err := fm.readControl()
+	if err != nil {
+		return fmt.Errorf("fm.readControl: %w", err)
+	}
+	if c.Version > FormatVersion {
+		return &IncompatibleError{
+			Setting:   "format version",
+			Stored:    strconv.FormatUint(uint64(c.Version), 10),
+			Requested: strconv.FormatUint(uint64(FormatVersion), 10),
+		}
+	}
+	if fm.stored {
+		if !exists {
+			return fmt.Errorf("%w: no control file", ErrNotDatabase)
+		}
+		fm.BlockSize, fm.checksums = c.BlockSize, c.Checksums
+	}
+	upgraded := c.Version < FormatVersion
+	for c.Version < FormatVersion {
+		upgrade, ok := upgrades[c.Version]
+		if !ok {
+			return fmt.Errorf("no upgrade from format version %d", c.Version)
+		}
+		if err := upgrade(fm, &c); err != nil {
+			return fmt.Errorf("upgrade from format version %d: %w", c.Version, err)
+		}
+		c.Version++
+	}
+
+	if c.BlockSize != fm.BlockSize {
+		return &IncompatibleError{
+			Setting:   "block size",
+			Stored:    strconv.Itoa(int(c.BlockSize)),
+			Requested: strconv.Itoa(int(fm.BlockSize)),
+		}
+	}
+	if c.Checksums != fm.checksums {
+		return &IncompatibleError{
+			Setting:   "checksums",
+			Stored:    strconv.FormatBool(c.Checksums),
+			Requested: strconv.FormatBool(fm.checksums),
+		}
+	}
+	if err := fm.validateKey(c); err != nil {
+		return err
+	}
+	fm.control = c
+	if upgraded {
+		return fm.writeControl(!exists)
+	}
+	return nil
+}
+
+// readControl reads the control file. A database without a control file has the version 0.
+func (fm *Manager) readControl() (Control, bool, error) {
+	name := path.Join(fm.DbDir, ControlFile)
+	exists, err := fm.vfs.Exists(name)
+	if err != nil {
+		return Control{}, false, fmt.Errorf("vfs.Exists: %w", err)
+	}
+	if !exists {
+		return Control{}, false, nil
+	}
+
+	f, err := fm.vfs.OpenFile(name)
+	if err != nil {
+		return Control{}, false, fmt.Errorf("vfs.OpenFile: %w", err)
+	}
+	defer f.Close()
+	b := make([]byte, controlSize)
+	n, err := f.ReadAt(b, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return Control{}, false, fmt.Errorf("f.ReadAt: %w", err)
+	}
+	if n < controlVersionOffset+4 {
+		return Control{}, false, fmt.Errorf("%w: control file is too short", ErrNotDatabase)
+	}
+	if string(b[:controlVersionOffset]) != controlMagic {
+		return Control{}, false, fmt.Errorf("%w: bad magic in control file", ErrNotDatabase)
+	}
+	c := Control{Version: binary.LittleEndian.Uint32(b[controlVersionOffset:])}
+	if c.Version > FormatVersion {
+		// the rest of the layout is unknown
+		return c, true, nil
+	}
+	if n < controlSize {
+		return Control{}, false, fmt.Errorf("%w: control file is too short", ErrNotDatabase)
+	}
+	if crc32.Checksum(b[:controlChecksumOffset], castagnoli) != binary.LittleEndian.Uint32(b[controlChecksumOffset:]) {
+		return Control{}, false, fmt.Errorf("%w: checksum mismatch in control file", ErrNotDatabase)
+	}
+	flags := binary.LittleEndian.Uint32(b[controlFlagsOffset:])
+	c.BlockSize = int32(binary.LittleEndian.Uint32(b[controlBlockSizeOffset:]))
+	c.Checksums = flags&controlFlagChecksums != 0
+	c.Encrypted = flags&controlFlagEncrypted != 0
+	c.CreatedAt = time.Unix(0, int64(binary.LittleEndian.Uint64(b[controlCreatedAtOffset:])))
+	copy(c.KeyID[:], b[controlKeyIDOffset:])
+	copy(c.PrevKeyID[:], b[controlPrevKeyIDOffset:])
+	return c, true, nil
+}
+
+// writeControl writes the control of the manager to the control file, and syncs it unless the durability is SyncNone.
+// The control file is small enough to be written by a single sector write, so it is overwritten in place.
+func (fm *Manager) writeControl(create bool) error {
+	b := make([]byte, controlSize)
+	copy(b, controlMagic)
+	binary.LittleEndian.PutUint32(b[controlVersionOffset:], fm.control.Version)
+	binary.LittleEndian.PutUint32(b[controlBlockSizeOffset:], uint32(fm.control.BlockSize))
+	var flags uint32
+	if fm.control.Checksums {
+		flags |= controlFlagChecksums
+	}
+	if fm.control.Encrypted {
+		flags |= controlFlagEncrypted
+	}
+	binary.LittleEndian.PutUint32(b[controlFlagsOffset:], flags)
+	binary.LittleEndian.PutUint64(b[controlCreatedAtOffset:], uint64(fm.control.CreatedAt.UnixNano()))
+	copy(b[controlKeyIDOffset:], fm.control.KeyID[:])
+	copy(b[controlPrevKeyIDOffset:], fm.control.PrevKeyID[:])
+	binary.LittleEndian.PutUint32(b[controlChecksumOffset:], crc32.Checksum(b[:controlChecksumOffset], castagnoli))
+
+	f, err := fm.vfs.OpenFile(path.Join(fm.DbDir, ControlFile))
+	if err != nil {
+		return fmt.Errorf("vfs.OpenFile: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.WriteAt(b, 0); err != nil {
+		return fmt.Errorf("f.WriteAt: %w", err)
+	}
+	if fm.durability == SyncNone {
+		return nil
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("f.Sync: %w", err)
+	}
+	if create {
+		if err := fm.syncDir(fm.DbDir); err != nil {
+			return fmt.Errorf("fm.syncDir: %w", err)
+		}
+	}
+	return nil
+}
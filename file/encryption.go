@@ -0,0 +1,322 @@
+package file
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+)
+
+// the trailer of an encrypted block holds the authentication tag of AES-GCM, followed by the nonce.
+const (
+	nonceSize          = 12
+	tagSize            = 16
+	encryptionOverhead = tagSize + nonceSize
+)
+
+// ErrKeyRotation is returned when a database is opened while the rotation of its key is unfinished.
+var ErrKeyRotation = errors.New("key rotation in progress")
+
+// KeyID identifies an encryption key without revealing it.
+type KeyID [8]byte
+
+// KeyIDOf returns the KeyID of the key.
+func KeyIDOf(key []byte) KeyID {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("simpledb key id"))
+	var id KeyID
+	copy(id[:], mac.Sum(nil))
+	return id
+}
+
+func (id KeyID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// WithEncryptionKey encrypts each block on disk with AES-GCM, using the key of 16, 24 or 32 bytes.
+// The pages keep BlockSize bytes; the authentication tag and the nonce are stored after each block.
+// The nonce of each write is random, so that it is not reused when a block is written again,
+// and the BlockID is authenticated, so that a block copied to another place does not decrypt.
+// The KeyID of the key is recorded in the control file, and a database must always be opened with the same key.
+func WithEncryptionKey(key []byte) Option {
+	return func(fm *Manager) {
+		fm.key = key
+	}
+}
+
+// withKeyRotation makes the manager write the blocks with newKey, and read them with either key.
+func withKeyRotation(newKey []byte) Option {
+	return func(fm *Manager) {
+		fm.rotateTo = newKey
+	}
+}
+
+// initCiphers creates the ciphers of the keys given as options.
+func (fm *Manager) initCiphers() error {
+	if fm.key == nil {
+		if fm.rotateTo != nil {
+			return errors.New("key rotation requires the current key")
+		}
+		return nil
+	}
+	aead, err := newAEAD(fm.key)
+	if err != nil {
+		return err
+	}
+	fm.aead = aead
+	if fm.rotateTo != nil {
+		if fm.prevAEAD, err = newAEAD(fm.rotateTo); err != nil {
+			return err
+		}
+		// the blocks are written with the new key
+		fm.aead, fm.prevAEAD = fm.prevAEAD, fm.aead
+	}
+	return nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("aes.NewCipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("cipher.NewGCM: %w", err)
+	}
+	return aead, nil
+}
+
+// blockAAD returns the data authenticated with the contents of the block.
+func blockAAD(blk BlockID) []byte {
+	return binary.LittleEndian.AppendUint32([]byte(blk.FileName), uint32(blk.Index))
+}
+
+// encrypt returns the encrypted page followed by its tag and nonce.
+func (fm *Manager) encrypt(blk BlockID, page []byte) []byte {
+	nonce := make([]byte, nonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		panic(fmt.Sprintf("rand.Read: %v", err)) // crypto/rand does not fail on the supported platforms
+	}
+	b := make([]byte, 0, len(page)+encryptionOverhead)
+	b = fm.aead.Seal(b, nonce, page, blockAAD(blk))
+	return append(b, nonce...)
+}
+
+// decrypt decrypts the bytes written by encrypt into the page.
+// While the key is rotated, the blocks not written yet with the new key are decrypted with the previous one.
+func (fm *Manager) decrypt(blk BlockID, b []byte, page []byte) error {
+	sealed, nonce := b[:len(b)-nonceSize], b[len(b)-nonceSize:]
+	for _, aead := range []cipher.AEAD{fm.aead, fm.prevAEAD} {
+		if aead == nil {
+			continue
+		}
+		if _, err := aead.Open(page[:0], nonce, sealed, blockAAD(blk)); err == nil {
+			return nil
+		}
+	}
+	return &CorruptBlockError{Block: blk, Reason: "authentication failed"}
+}
+
+// rotationJournal is the file in DbDir holding the blocks being rewritten by RotateKey.
+const rotationJournal = "simpledb.rotation"
+
+// journalBatch is the max number of consecutive blocks rewritten through the journal at once.
+const journalBatch = 64
+
+// RotateKey encrypts every file of the encrypted database in dbDir with newKey instead of oldKey.
+// The block size and the checksums are read from the control file, and the options need not give them.
+// The database must not be in use. The control file records both keys meanwhile, so that an interrupted rotation
+// is completed by calling RotateKey again with the same keys; until then, the database cannot be opened.
+// The blocks are rewritten in place after being written to a journal, from which a block torn by the interruption
+// is restored when the rotation is resumed.
+func RotateKey(dbDir string, oldKey, newKey []byte, opts ...Option) error {
+	if bytes.Equal(oldKey, newKey) {
+		return errors.New("the new key is the same as the old key")
+	}
+	fm, err := NewManager(dbDir, 0, append(opts, withStoredFormat(), WithEncryptionKey(oldKey), withKeyRotation(newKey))...)
+	if err != nil {
+		return fmt.Errorf("file.NewManager: %w", err)
+	}
+	defer fm.Close()
+
+	fm.control.KeyID = KeyIDOf(newKey)
+	fm.control.PrevKeyID = KeyIDOf(oldKey)
+	if err := fm.writeControl(false); err != nil {
+		return fmt.Errorf("fm.writeControl: %w", err)
+	}
+
+	journalPath := path.Join(fm.DbDir, rotationJournal)
+	journal, err := fm.vfs.OpenFile(journalPath)
+	if err != nil {
+		return fmt.Errorf("vfs.OpenFile: %w", err)
+	}
+	defer journal.Close()
+	if err := fm.syncDir(fm.DbDir); err != nil {
+		return fmt.Errorf("fm.syncDir: %w", err)
+	}
+	if err := fm.replayJournal(journal); err != nil {
+		return fmt.Errorf("fm.replayJournal: %w", err)
+	}
+
+	names, err := fm.vfs.ReadDir(fm.DbDir)
+	if err != nil {
+		return fmt.Errorf("vfs.ReadDir: %w", err)
+	}
+	p := NewPage(fm.BlockSize)
+	for _, name := range names {
+		if name == ControlFile || name == rotationJournal || isTempFile(name) {
+			continue
+		}
+		n, err := fm.Length(name)
+		if err != nil {
+			return fmt.Errorf("fm.Length: %w", err)
+		}
+		for start := int32(0); start < n; start += journalBatch {
+			var images [][]byte
+			for i := start; i < min(start+journalBatch, n); i++ {
+				blk := NewBlockID(name, i)
+				if err := fm.Load(blk, p); err != nil {
+					return fmt.Errorf("fm.Load: %w", err)
+				}
+				images = append(images, fm.encode(blk, p.Buffer))
+			}
+			if err := fm.writeJournaled(journal, NewBlockID(name, start), images); err != nil {
+				return fmt.Errorf("fm.writeJournaled: %w", err)
+			}
+		}
+	}
+
+	if err := journal.Close(); err != nil {
+		return fmt.Errorf("journal.Close: %w", err)
+	}
+	if err := fm.vfs.Remove(journalPath); err != nil {
+		return fmt.Errorf("vfs.Remove: %w", err)
+	}
+	if err := fm.syncDir(fm.DbDir); err != nil {
+		return fmt.Errorf("fm.syncDir: %w", err)
+	}
+	fm.control.PrevKeyID = KeyID{}
+	if err := fm.writeControl(false); err != nil {
+		return fmt.Errorf("fm.writeControl: %w", err)
+	}
+	return nil
+}
+
+// the journal holds the index of the first block, the number of blocks and the file name, followed by the blocks on disk.
+const journalHeaderSize = 12
+
+// writeJournaled writes the consecutive blocks on disk starting from first to the journal, and then in place.
+// The journal is synced before the blocks are written in place, so that a block torn by a crash can be restored from it.
+func (fm *Manager) writeJournaled(journal VFile, first BlockID, images [][]byte) error {
+	b := binary.LittleEndian.AppendUint32(nil, uint32(first.Index))
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(images)))
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(first.FileName)))
+	b = append(b, first.FileName...)
+	blocks := bytes.Join(images, nil)
+	if _, err := journal.WriteAt(append(b, blocks...), 0); err != nil {
+		return fmt.Errorf("journal.WriteAt: %w", err)
+	}
+	f, err := fm.open(first.FileName)
+	if err != nil {
+		return fmt.Errorf("fm.open: %w", err)
+	}
+	if fm.durability != SyncNone {
+		if err := journal.Sync(); err != nil {
+			return fmt.Errorf("journal.Sync: %w", err)
+		}
+	}
+	if _, err := f.WriteAt(blocks, fm.offset(first)); err != nil {
+		return fmt.Errorf("f.WriteAt: %w", err)
+	}
+	if fm.durability != SyncNone {
+		if err := f.Sync(); err != nil {
+			return fmt.Errorf("f.Sync: %w", err)
+		}
+	}
+	return nil
+}
+
+// replayJournal writes back in place the blocks of the journal left by an interrupted rotation.
+// Only the blocks that verify are written, since the journal itself may have been torn;
+// the blocks written to the journal are never modified afterwards, so rewriting them is harmless.
+func (fm *Manager) replayJournal(journal VFile) error {
+	size, err := journal.Size()
+	if err != nil {
+		return fmt.Errorf("journal.Size: %w", err)
+	}
+	b := make([]byte, size)
+	if _, err := journal.ReadAt(b, 0); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("journal.ReadAt: %w", err)
+	}
+	if len(b) < journalHeaderSize {
+		return nil
+	}
+	index := int32(binary.LittleEndian.Uint32(b))
+	count := int(binary.LittleEndian.Uint32(b[4:]))
+	nameLen := int(binary.LittleEndian.Uint32(b[8:]))
+	if nameLen > len(b)-journalHeaderSize {
+		return nil
+	}
+	name := string(b[journalHeaderSize : journalHeaderSize+nameLen])
+	b = b[journalHeaderSize+nameLen:]
+
+	size = int64(fm.diskBlockSize())
+	page := make([]byte, fm.BlockSize)
+	for i := range min(count, len(b)/int(size)) {
+		blk := NewBlockID(name, index+int32(i))
+		image := b[int64(i)*size : int64(i+1)*size]
+		if fm.decode(blk, image, page) != nil {
+			continue
+		}
+		f, err := fm.open(name)
+		if err != nil {
+			return fmt.Errorf("fm.open: %w", err)
+		}
+		if _, err := f.WriteAt(image, fm.offset(blk)); err != nil {
+			return fmt.Errorf("f.WriteAt: %w", err)
+		}
+		if fm.durability != SyncNone {
+			if err := f.Sync(); err != nil {
+				return fmt.Errorf("f.Sync: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// validateKey checks the key the manager is opened with against the control c.
+func (fm *Manager) validateKey(c Control) error {
+	if c.Encrypted != (fm.aead != nil) {
+		return &IncompatibleError{
+			Setting:   "encryption",
+			Stored:    strconv.FormatBool(c.Encrypted),
+			Requested: strconv.FormatBool(fm.aead != nil),
+		}
+	}
+	if !c.Encrypted {
+		return nil
+	}
+
+	oldID, newID := KeyIDOf(fm.key), KeyID{}
+	if fm.rotateTo != nil {
+		newID = KeyIDOf(fm.rotateTo)
+	}
+	switch {
+	case c.PrevKeyID == (KeyID{}) && c.KeyID == oldID:
+		return nil
+	case c.PrevKeyID != (KeyID{}) && fm.rotateTo != nil && c.PrevKeyID == oldID && c.KeyID == newID:
+		return nil // resume the rotation
+	case c.PrevKeyID != (KeyID{}):
+		return fmt.Errorf("%w from key %v to key %v in %s", ErrKeyRotation, c.PrevKeyID, c.KeyID, path.Clean(fm.DbDir))
+	}
+	return &IncompatibleError{Setting: "encryption key", Stored: c.KeyID.String(), Requested: oldID.String()}
+}
@@ -1,13 +1,14 @@
 package file
 
 import (
+	"crypto/cipher"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
-	"os"
 	"path"
-	"strings"
+	"slices"
+	"sync"
 	"unicode/utf16"
 )
 
@@ -99,60 +100,128 @@ func MaxLength(length int) int32 {
 	return Int32ByteSize + int32(length)*Utf16ByteSize
 }
 
+// Durability is when the writes to the files are synced to the storage device.
+type Durability int
+
+const (
+	// SyncAlways syncs every Save and Extend, so a written block survives a power loss.
+	SyncAlways Durability = iota
+	// SyncLog syncs only when the log is flushed. The other files are synced before the log,
+	// so that the blocks written by a transaction are durable once its commit record is.
+	SyncLog
+	// SyncNone never syncs, and is meant for tests.
+	SyncNone
+)
+
+// Option configures a Manager.
+type Option func(*Manager)
+
+// WithDurability sets when the writes are synced. The default is SyncAlways.
+func WithDurability(d Durability) Option {
+	return func(fm *Manager) {
+		fm.durability = d
+	}
+}
+
+// Manager reads and writes the blocks of the files in DbDir of its VFS, and is safe for concurrent use.
+// The files are opened once and shared; the blocks are accessed with ReadAt and WriteAt, which do not move the file offset.
 type Manager struct {
 	DbDir     string
 	BlockSize int32
-	files     map[string]*os.File
+	IsNew     bool // true if DbDir was created by this manager
+
+	vfs        VFS
+	durability Durability
+	checksums  bool
+	control    Control
+	stored     bool // the format is read from the control file of an existing database
+
+	key      []byte      // the encryption key
+	rotateTo []byte      // the new key, while the key is rotated
+	aead     cipher.AEAD // encrypts the blocks, if there is a key
+	prevAEAD cipher.AEAD // decrypts the blocks not written yet with the new key, while the key is rotated
+
+	mu       sync.RWMutex // guards files, unsynced, temps and lastTemp
+	files    map[string]VFile
+	unsynced map[string]bool // the files written since their last sync, with SyncLog
+	temps    map[string]bool // the temporary files in flight
+	lastTemp uint64
+	extendMu sync.Mutex // serializes Extend, so that concurrent calls append different blocks
 }
 
-func NewManager(dbDir string, blockSize int32) (*Manager, error) {
-	// if not exist, create DbDir recursively
-	if _, err := os.Stat(dbDir); err != nil {
-		if !os.IsNotExist(err) {
-			return nil, fmt.Errorf("os.Stat: %w", err)
-		}
-		err = os.MkdirAll(dbDir, 0o700)
-		if err != nil {
-			return nil, fmt.Errorf("os.MkdirAll: %w", err)
-		}
+func NewManager(dbDir string, blockSize int32, opts ...Option) (*Manager, error) {
+	fm := &Manager{
+		DbDir:      dbDir,
+		BlockSize:  blockSize,
+		vfs:        NewOSVFS(),
+		durability: SyncAlways,
+		files:      make(map[string]VFile),
+		unsynced:   make(map[string]bool),
+		temps:      make(map[string]bool),
+	}
+	for _, opt := range opts {
+		opt(fm)
+	}
+	if err := fm.initCiphers(); err != nil {
+		return nil, fmt.Errorf("fm.initCiphers: %w", err)
 	}
 
-	// remove any leftover temp files
-	files, err := os.ReadDir(dbDir)
+	// if not exist, create DbDir recursively
+	exists, err := fm.vfs.Exists(dbDir)
 	if err != nil {
-		return nil, fmt.Errorf("os.ReadDir: %w", err)
+		return nil, fmt.Errorf("vfs.Exists: %w", err)
+	}
+	isNew := !exists
+	if isNew && fm.stored {
+		return nil, fmt.Errorf("no database in %s", path.Clean(dbDir))
 	}
-	for _, file := range files {
-		if !strings.HasPrefix(file.Name(), "temp") {
-			continue
+	if isNew {
+		if err := fm.vfs.MkdirAll(dbDir); err != nil {
+			return nil, fmt.Errorf("vfs.MkdirAll: %w", err)
 		}
-
-		if err = os.Remove(file.Name()); err != nil {
-			return nil, fmt.Errorf("os.Remove: %w", err)
+		if err := fm.syncDir(path.Dir(path.Clean(dbDir))); err != nil {
+			return nil, fmt.Errorf("fm.syncDir: %w", err)
 		}
 	}
-	return &Manager{
-		DbDir:     dbDir,
-		BlockSize: blockSize,
-		files:     make(map[string]*os.File),
-	}, nil
+	fm.IsNew = isNew
+	// the temporary files are removed first, since a half-written one is not made of whole blocks
+	if err := fm.removeLeftoverTempFiles(); err != nil {
+		return nil, fmt.Errorf("fm.removeLeftoverTempFiles: %w", err)
+	}
+	if err := fm.initControl(isNew); err != nil {
+		return nil, fmt.Errorf("fm.initControl: %w", err)
+	}
+	if v, ok := fm.vfs.(*FaultVFS); ok {
+		v.setDiskBlockSize(fm.diskBlockSize())
+	}
+	return fm, nil
 }
 
 // Load bytes corresponds block ID from disk into a page
 func (fm *Manager) Load(blk BlockID, p *Page) error {
-	f, err := fm.open(blk.FileName)
-	if err != nil {
-		return fmt.Errorf("fm.open: %w", err)
-	}
+	return fm.LoadBlocks(blk, []*Page{p})
+}
 
-	_, err = f.Seek(int64(fm.BlockSize*blk.Index), 0)
+// LoadBlocks reads the consecutive blocks starting from first into the pages with a single read.
+// The blocks beyond the end of the file read as zeros.
+func (fm *Manager) LoadBlocks(first BlockID, pages []*Page) error {
+	f, err := fm.open(first.FileName)
 	if err != nil {
-		return fmt.Errorf("f.Seek: %w", err)
+		return fmt.Errorf("fm.open: %w", err)
 	}
 
-	_, err = f.Read(p.Buffer)
+	size := fm.diskBlockSize()
+	b := make([]byte, size*len(pages))
+	n, err := f.ReadAt(b, fm.offset(first))
 	if err != nil && !errors.Is(err, io.EOF) {
-		return fmt.Errorf("f.Read: %w", err)
+		return fmt.Errorf("f.ReadAt: %w", err)
+	}
+	for i, p := range pages {
+		blk := NewBlockID(first.FileName, first.Index+int32(i))
+		read := min(max(n-i*size, 0), size)
+		if err := fm.decode(blk, b[i*size:i*size+read], p.Buffer); err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -160,44 +229,124 @@ func (fm *Manager) Load(blk BlockID, p *Page) error {
 
 // Save the contents of the page to the specified block.
 func (fm *Manager) Save(blk BlockID, p *Page) error {
+	return fm.write(blk, p.Buffer)
+}
+
+func (fm *Manager) write(blk BlockID, page []byte) error {
 	f, err := fm.open(blk.FileName)
 	if err != nil {
 		return fmt.Errorf("fm.open: %w", err)
 	}
+	if fm.checksums || fm.aead != nil {
+		n, err := fm.Length(blk.FileName)
+		if err != nil {
+			return fmt.Errorf("fm.Length: %w", err)
+		}
+		if blk.Index >= n {
+			// serialized with Extend, so that the blocks beyond the end are not written concurrently
+			fm.extendMu.Lock()
+			defer fm.extendMu.Unlock()
+			return fm.writeBeyondEnd(f, blk, page)
+		}
+	}
+	return fm.writeBlock(f, blk, page)
+}
 
-	_, err = f.Seek(int64(fm.BlockSize*blk.Index), 0)
+// writeBeyondEnd writes the block at or beyond the end of the file, after empty blocks filling the gap,
+// so that every block in the file can be verified. The caller must hold extendMu.
+func (fm *Manager) writeBeyondEnd(f VFile, blk BlockID, page []byte) error {
+	n, err := fm.Length(blk.FileName)
 	if err != nil {
-		return fmt.Errorf("f.Seek: %w", err)
+		return fmt.Errorf("fm.Length: %w", err)
+	}
+	empty := make([]byte, fm.BlockSize)
+	for i := n; i < blk.Index; i++ {
+		if err := fm.writeBlock(f, NewBlockID(blk.FileName, i), empty); err != nil {
+			return err
+		}
+	}
+	return fm.writeBlock(f, blk, page)
+}
+
+func (fm *Manager) writeBlock(f VFile, blk BlockID, page []byte) error {
+	if _, err := f.WriteAt(fm.encode(blk, page), fm.offset(blk)); err != nil {
+		return fmt.Errorf("f.WriteAt: %w", err)
+	}
+	switch fm.durability {
+	case SyncAlways:
+		if err := f.Sync(); err != nil {
+			return fmt.Errorf("f.Sync: %w", err)
+		}
+	case SyncLog:
+		fm.mu.Lock()
+		fm.unsynced[blk.FileName] = true
+		fm.mu.Unlock()
 	}
 
-	_, err = f.Write(p.Buffer)
-	if err != nil {
-		return fmt.Errorf("f.Write: %w", err)
+	return nil
+}
+
+// Sync makes the writes to the file durable, unless the durability is SyncNone.
+// With SyncLog, the other files written since their last sync are synced first.
+// With SyncAlways, every write is already synced, so it does nothing.
+func (fm *Manager) Sync(filename string) error {
+	if fm.durability != SyncLog {
+		return nil
 	}
 
+	fm.mu.Lock()
+	var names []string
+	for name := range fm.unsynced {
+		if name != filename {
+			names = append(names, name)
+		}
+		delete(fm.unsynced, name)
+	}
+	fm.mu.Unlock()
+	slices.Sort(names)
+
+	names = append(names, filename)
+	for i, name := range names {
+		if err := fm.syncFile(name); err != nil {
+			// sync the failed file and the following ones again next time
+			fm.mu.Lock()
+			for _, name := range names[i:] {
+				fm.unsynced[name] = true
+			}
+			fm.mu.Unlock()
+			return err
+		}
+	}
+	return nil
+}
+
+func (fm *Manager) syncFile(name string) error {
+	f, err := fm.open(name)
+	if err != nil {
+		return fmt.Errorf("fm.open: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("f.Sync: %w", err)
+	}
 	return nil
 }
 
+// Extend appends an empty block to the file, and returns it.
 func (fm *Manager) Extend(filename string) (BlockID, error) {
+	fm.extendMu.Lock()
+	defer fm.extendMu.Unlock()
+
 	newBlockIndex, err := fm.Length(filename) // Length == Index + 1
 	if err != nil {
 		return BlockID{}, fmt.Errorf("fm.Length: %w", err)
 	}
 	blk := NewBlockID(filename, newBlockIndex)
-	b := make([]byte, fm.BlockSize)
-
-	f, err := fm.open(blk.FileName)
+	f, err := fm.open(filename)
 	if err != nil {
 		return BlockID{}, fmt.Errorf("fm.open: %w", err)
 	}
-
-	_, err = f.Seek(int64(fm.BlockSize*blk.Index), 0)
-	if err != nil {
-		return BlockID{}, fmt.Errorf("f.Seek: %w", err)
-	}
-	_, err = f.Write(b)
-	if err != nil {
-		return BlockID{}, fmt.Errorf("f.Write: %w", err)
+	if err := fm.writeBlock(f, blk, make([]byte, fm.BlockSize)); err != nil {
+		return BlockID{}, fmt.Errorf("fm.writeBlock: %w", err)
 	}
 
 	return blk, nil
@@ -210,22 +359,81 @@ func (fm *Manager) Length(filename string) (int32, error) {
 		return 0, fmt.Errorf("fm.open: %w", err)
 	}
 
-	fi, err := f.Stat()
+	size, err := f.Size()
 	if err != nil {
-		return 0, fmt.Errorf("f.Stat: %w", err)
+		return 0, fmt.Errorf("f.Size: %w", err)
 	}
 
-	return int32(fi.Size()) / fm.BlockSize, nil
+	return int32(size / int64(fm.diskBlockSize())), nil
 }
 
-func (fm *Manager) open(fileName string) (*os.File, error) {
-	if f, ok := fm.files[fileName]; ok {
+// Close closes the open files, and removes the temporary files in flight. A file used afterwards is opened again.
+func (fm *Manager) Close() error {
+	fm.mu.Lock()
+	var errs []error
+	for name, f := range fm.files {
+		if err := f.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("f.Close: %w", err))
+		}
+		delete(fm.files, name)
+	}
+	temps := fm.temps
+	fm.temps = make(map[string]bool)
+	fm.mu.Unlock()
+
+	// the files are removed without holding mu
+	for name := range temps {
+		if err := fm.removeTempFiles(name); err != nil {
+			errs = append(errs, fmt.Errorf("fm.removeTempFiles: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// syncDir syncs the directory, so that the files created in it are durable, unless the durability is SyncNone.
+func (fm *Manager) syncDir(dir string) error {
+	if fm.durability == SyncNone {
+		return nil
+	}
+	if err := fm.vfs.SyncDir(dir); err != nil {
+		return fmt.Errorf("vfs.SyncDir: %w", err)
+	}
+	return nil
+}
+
+func (fm *Manager) offset(blk BlockID) int64 {
+	return int64(fm.diskBlockSize()) * int64(blk.Index)
+}
+
+func (fm *Manager) open(fileName string) (VFile, error) {
+	fm.mu.RLock()
+	f, ok := fm.files[fileName]
+	fm.mu.RUnlock()
+	if ok {
 		return f, nil
 	}
 
-	f, err := os.OpenFile(path.Join(fm.DbDir, fileName), os.O_RDWR|os.O_CREATE, 0o600)
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+	// another goroutine may have opened it meanwhile
+	if f, ok := fm.files[fileName]; ok {
+		return f, nil
+	}
+	// the directory entry of a new file must be synced too, or the file may vanish after a power loss
+	filePath := path.Join(fm.DbDir, fileName)
+	exists, err := fm.vfs.Exists(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("vfs.Exists: %w", err)
+	}
+	f, err = fm.vfs.OpenFile(filePath)
 	if err != nil {
-		return nil, fmt.Errorf("os.OpenFile: %w", err)
+		return nil, fmt.Errorf("vfs.OpenFile: %w", err)
+	}
+	if !exists {
+		if err := fm.syncDir(fm.DbDir); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("fm.syncDir: %w", err)
+		}
 	}
 
 	fm.files[fileName] = f
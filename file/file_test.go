@@ -1,10 +1,16 @@
 package file_test
 
 import (
+	"bytes"
 	"ddai-go/file"
 	"ddai-go/server"
+	"errors"
 	"fmt"
+	"os"
 	"path"
+	"slices"
+	"sync"
+	"syscall"
 	"testing"
 )
 
@@ -70,3 +76,915 @@ func TestFile(t *testing.T) {
 		t.Errorf("actInt2=%d, want %d", actInt2, inInt2)
 	}
 }
+
+func TestLoadBlocks(t *testing.T) {
+	t.Parallel()
+
+	fm, err := file.NewManager(path.Join(t.TempDir(), "loadblockstest"), 400)
+	if err != nil {
+		t.Fatalf("file.NewManager: %v", err)
+	}
+	p := file.NewPage(fm.BlockSize)
+	for i := range int32(3) {
+		p.SetInt(0, 100+i)
+		if err := fm.Save(file.NewBlockID("testfile", i), p); err != nil {
+			t.Fatalf("fm.Save: %v", err)
+		}
+	}
+
+	// blocks 1 and 2 exist, and block 3 is beyond the end of the file
+	pages := []*file.Page{file.NewPage(400), file.NewPage(400), file.NewPage(400)}
+	pages[2].SetInt(0, 999)
+	if err := fm.LoadBlocks(file.NewBlockID("testfile", 1), pages); err != nil {
+		t.Fatalf("fm.LoadBlocks: %v", err)
+	}
+	for i, want := range []int32{101, 102, 0} {
+		if got := pages[i].GetInt(0); got != want {
+			t.Errorf("pages[%d] holds %d, want %d", i, got, want)
+		}
+	}
+}
+
+func TestManagerConcurrentAccess(t *testing.T) {
+	t.Parallel()
+
+	fm, err := file.NewManager(path.Join(t.TempDir(), "concurrenttest"), 400)
+	if err != nil {
+		t.Fatalf("file.NewManager: %v", err)
+	}
+
+	const (
+		numGoroutines = 16
+		numBlocks     = 50
+	)
+	// each goroutine writes and reads back its own blocks, interleaved with the others in two shared files
+	var wg sync.WaitGroup
+	errs := make(chan error, numGoroutines)
+	for g := range int32(numGoroutines) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			filename := fmt.Sprintf("testfile%d", g%2)
+			p := file.NewPage(fm.BlockSize)
+			for i := range int32(numBlocks) {
+				blk := file.NewBlockID(filename, i*numGoroutines/2+g/2)
+				p.SetInt(0, g)
+				p.SetInt(396, i)
+				if err := fm.Save(blk, p); err != nil {
+					errs <- err
+					return
+				}
+				if err := fm.Load(blk, p); err != nil {
+					errs <- err
+					return
+				}
+				if got0, got1 := p.GetInt(0), p.GetInt(396); got0 != g || got1 != i {
+					errs <- fmt.Errorf("%v holds %d, %d, want %d, %d", blk, got0, got1, g, i)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+}
+
+func TestManagerConcurrentExtend(t *testing.T) {
+	t.Parallel()
+
+	fm, err := file.NewManager(path.Join(t.TempDir(), "extendtest"), 400)
+	if err != nil {
+		t.Fatalf("file.NewManager: %v", err)
+	}
+
+	const numGoroutines = 32
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		blocks = make(map[int32]bool)
+	)
+	for range numGoroutines {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			blk, err := fm.Extend("testfile")
+			if err != nil {
+				t.Errorf("fm.Extend: %v", err)
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if blocks[blk.Index] {
+				t.Errorf("block %d appended twice", blk.Index)
+			}
+			blocks[blk.Index] = true
+		}()
+	}
+	wg.Wait()
+
+	if n, err := fm.Length("testfile"); err != nil || n != numGoroutines {
+		t.Errorf("fm.Length()=%d, %v, want %d", n, err, numGoroutines)
+	}
+	if err := fm.Close(); err != nil {
+		t.Fatalf("fm.Close: %v", err)
+	}
+	// the file is opened again after Close
+	if n, err := fm.Length("testfile"); err != nil || n != numGoroutines {
+		t.Errorf("fm.Length() after Close=%d, %v, want %d", n, err, numGoroutines)
+	}
+}
+
+func TestManagerDurability(t *testing.T) {
+	t.Parallel()
+
+	for _, d := range []file.Durability{file.SyncAlways, file.SyncLog, file.SyncNone} {
+		t.Run(fmt.Sprint(d), func(t *testing.T) {
+			t.Parallel()
+
+			// the parent directories are created too
+			dbDir := path.Join(t.TempDir(), "parent", "durabilitytest")
+			fm, err := file.NewManager(dbDir, 400, file.WithDurability(d))
+			if err != nil {
+				t.Fatalf("file.NewManager: %v", err)
+			}
+			if !fm.IsNew {
+				t.Errorf("fm.IsNew=false for a new directory")
+			}
+
+			blk, err := fm.Extend("testfile")
+			if err != nil {
+				t.Fatalf("fm.Extend: %v", err)
+			}
+			p := file.NewPage(400)
+			p.SetInt(0, 123)
+			if err := fm.Save(blk, p); err != nil {
+				t.Fatalf("fm.Save: %v", err)
+			}
+			if err := fm.Sync("testfile"); err != nil {
+				t.Fatalf("fm.Sync: %v", err)
+			}
+
+			// the block is read by another manager
+			fm2, err := file.NewManager(dbDir, 400, file.WithDurability(d))
+			if err != nil {
+				t.Fatalf("file.NewManager: %v", err)
+			}
+			if fm2.IsNew {
+				t.Errorf("fm.IsNew=true for an existing directory")
+			}
+			if err := fm2.Load(blk, p); err != nil {
+				t.Fatalf("fm.Load: %v", err)
+			}
+			if got := p.GetInt(0); got != 123 {
+				t.Errorf("value=%d, want 123", got)
+			}
+		})
+	}
+}
+
+func TestManagerChecksums(t *testing.T) {
+	t.Parallel()
+
+	dbDir := path.Join(t.TempDir(), "checksumtest")
+	fm, err := file.NewManager(dbDir, 400, file.WithChecksums())
+	if err != nil {
+		t.Fatalf("file.NewManager: %v", err)
+	}
+	p := file.NewPage(fm.BlockSize)
+	for _, i := range []int32{0, 1, 2, 5} { // blocks 3 and 4 are written empty
+		p.SetInt(0, 100+i)
+		if err := fm.Save(file.NewBlockID("testfile", i), p); err != nil {
+			t.Fatalf("fm.Save: %v", err)
+		}
+	}
+	for i, want := range []int32{100, 101, 102, 0, 0, 105, 0} {
+		if err := fm.Load(file.NewBlockID("testfile", int32(i)), p); err != nil {
+			t.Fatalf("fm.Load(%d): %v", i, err)
+		}
+		if got := p.GetInt(0); got != want {
+			t.Errorf("block %d holds %d, want %d", i, got, want)
+		}
+	}
+	if n, err := fm.Length("testfile"); err != nil || n != 6 {
+		t.Errorf("fm.Length()=%d, %v, want 6", n, err)
+	}
+	if corrupt, err := fm.Scrub(); err != nil || len(corrupt) != 0 {
+		t.Errorf("fm.Scrub()=%v, %v, want no corrupt block", corrupt, err)
+	}
+
+	// flip a byte of block 1, zero block 3, and tear block 5
+	f, err := os.OpenFile(path.Join(dbDir, "testfile"), os.O_RDWR, 0)
+	if err != nil {
+		t.Fatalf("os.OpenFile: %v", err)
+	}
+	diskBlockSize := int64(404)
+	if _, err := f.WriteAt([]byte{0xff}, diskBlockSize+10); err != nil {
+		t.Fatalf("f.WriteAt: %v", err)
+	}
+	if _, err := f.WriteAt(make([]byte, diskBlockSize), diskBlockSize*3); err != nil {
+		t.Fatalf("f.WriteAt: %v", err)
+	}
+	if err := f.Truncate(diskBlockSize*5 + 100); err != nil {
+		t.Fatalf("f.Truncate: %v", err)
+	}
+	f.Close()
+
+	blk1 := file.NewBlockID("testfile", 1)
+	err = fm.Load(blk1, p)
+	var corruptErr *file.CorruptBlockError
+	if !errors.Is(err, file.ErrCorruptBlock) || !errors.As(err, &corruptErr) || corruptErr.Block != blk1 {
+		t.Errorf("fm.Load of a modified block: got %v, want CorruptBlockError for %v", err, blk1)
+	}
+	corrupt, err := fm.Scrub()
+	if err != nil {
+		t.Fatalf("fm.Scrub: %v", err)
+	}
+	var blocks []file.BlockID
+	for _, c := range corrupt {
+		blocks = append(blocks, c.Block)
+	}
+	if want := []file.BlockID{blk1, file.NewBlockID("testfile", 3), file.NewBlockID("testfile", 5)}; !slices.Equal(blocks, want) {
+		t.Errorf("fm.Scrub() found %v, want %v", blocks, want)
+	}
+}
+
+func TestSimpleDBWithChecksums(t *testing.T) {
+	t.Parallel()
+
+	dbDir := path.Join(t.TempDir(), "checksumdbtest")
+	blk := file.NewBlockID("testfile", 0)
+	for i := range int32(3) {
+		db, err := server.NewSimpleDB(dbDir, 400, 8, server.WithFileOptions(file.WithChecksums()))
+		if err != nil {
+			t.Fatalf("server.NewSimpleDB: %v", err)
+		}
+		tx := db.NewTx()
+		if err := tx.Pin(blk); err != nil {
+			t.Fatalf("tx.Pin: %v", err)
+		}
+		got, err := tx.GetInt(blk, 80)
+		if err != nil {
+			t.Fatalf("tx.GetInt: %v", err)
+		}
+		if got != i {
+			t.Errorf("value=%d, want %d", got, i)
+		}
+		if err := tx.SetInt(blk, 80, i+1, true); err != nil {
+			t.Fatalf("tx.SetInt: %v", err)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatalf("tx.Commit: %v", err)
+		}
+		if err := db.Close(); err != nil {
+			t.Fatalf("db.Close: %v", err)
+		}
+		if corrupt, err := db.FileManager.Scrub(); err != nil || len(corrupt) != 0 {
+			t.Errorf("fm.Scrub()=%v, %v, want no corrupt block", corrupt, err)
+		}
+	}
+}
+
+func TestManagerMemVFS(t *testing.T) {
+	t.Parallel()
+
+	vfs := file.NewMemVFS()
+	fm, err := file.NewManager("memtest", 400, file.WithVFS(vfs), file.WithChecksums())
+	if err != nil {
+		t.Fatalf("file.NewManager: %v", err)
+	}
+	if !fm.IsNew {
+		t.Errorf("fm.IsNew=false for a new directory")
+	}
+	blk, err := fm.Extend("testfile")
+	if err != nil {
+		t.Fatalf("fm.Extend: %v", err)
+	}
+	p := file.NewPage(400)
+	p.SetString(0, "hello")
+	if err := fm.Save(blk, p); err != nil {
+		t.Fatalf("fm.Save: %v", err)
+	}
+
+	// nothing is written to the disk
+	if _, err := os.Stat("memtest"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("os.Stat: got %v, want ErrNotExist", err)
+	}
+	fm2, err := file.NewManager("memtest", 400, file.WithVFS(vfs), file.WithChecksums())
+	if err != nil {
+		t.Fatalf("file.NewManager: %v", err)
+	}
+	if fm2.IsNew {
+		t.Errorf("fm.IsNew=true for an existing directory")
+	}
+	if err := fm2.Load(blk, p); err != nil {
+		t.Fatalf("fm.Load: %v", err)
+	}
+	if got := p.GetString(0); got != "hello" {
+		t.Errorf("value=%q, want hello", got)
+	}
+	if corrupt, err := fm2.Scrub(); err != nil || len(corrupt) != 0 {
+		t.Errorf("fm.Scrub()=%v, %v, want no corrupt block", corrupt, err)
+	}
+}
+
+func TestFaultVFS(t *testing.T) {
+	t.Parallel()
+
+	blk0 := file.NewBlockID("testfile", 0)
+	blk1 := file.NewBlockID("testfile", 1)
+	open := func(t *testing.T, vfs file.VFS, d file.Durability) *file.Manager {
+		t.Helper()
+		fm, err := file.NewManager("faulttest", 400, file.WithVFS(vfs), file.WithDurability(d), file.WithChecksums())
+		if err != nil {
+			t.Fatalf("file.NewManager: %v", err)
+		}
+		return fm
+	}
+	save := func(t *testing.T, fm *file.Manager, blk file.BlockID, val int32) {
+		t.Helper()
+		p := file.NewPage(400)
+		p.SetInt(0, val)
+		if err := fm.Save(blk, p); err != nil {
+			t.Fatalf("fm.Save: %v", err)
+		}
+	}
+	load := func(t *testing.T, fm *file.Manager, blk file.BlockID) (int32, error) {
+		t.Helper()
+		p := file.NewPage(400)
+		err := fm.Load(blk, p)
+		return p.GetInt(0), err
+	}
+
+	t.Run("EIO", func(t *testing.T) {
+		t.Parallel()
+
+		vfs := file.NewFaultVFS(file.NewMemVFS())
+		fm := open(t, vfs, file.SyncAlways)
+		save(t, fm, blk0, 1)
+		save(t, fm, blk1, 2)
+
+		vfs.FailReads(blk1)
+		vfs.FailWrites(blk0)
+		if _, err := load(t, fm, blk1); !errors.Is(err, syscall.EIO) {
+			t.Errorf("fm.Load(blk1): got %v, want EIO", err)
+		}
+		if got, err := load(t, fm, blk0); err != nil || got != 1 {
+			t.Errorf("fm.Load(blk0)=%d, %v, want 1", got, err)
+		}
+		p := file.NewPage(400)
+		if err := fm.Save(blk0, p); !errors.Is(err, syscall.EIO) {
+			t.Errorf("fm.Save(blk0): got %v, want EIO", err)
+		}
+		// a read covering the failing block fails too
+		if err := fm.LoadBlocks(blk0, []*file.Page{p, p}); !errors.Is(err, syscall.EIO) {
+			t.Errorf("fm.LoadBlocks: got %v, want EIO", err)
+		}
+
+		vfs.ClearFaults()
+		if got, err := load(t, fm, blk1); err != nil || got != 2 {
+			t.Errorf("fm.Load(blk1) after ClearFaults=%d, %v, want 2", got, err)
+		}
+	})
+
+	t.Run("crash drops unsynced writes", func(t *testing.T) {
+		t.Parallel()
+
+		vfs := file.NewFaultVFS(file.NewMemVFS())
+		fm := open(t, vfs, file.SyncLog)
+		save(t, fm, blk0, 1)
+		if err := fm.Sync("testfile"); err != nil {
+			t.Fatalf("fm.Sync: %v", err)
+		}
+		save(t, fm, blk0, 2)
+		save(t, fm, blk1, 3)
+		save(t, fm, file.NewBlockID("otherfile", 0), 4)
+
+		if err := vfs.Crash(); err != nil {
+			t.Fatalf("vfs.Crash: %v", err)
+		}
+		fm = open(t, vfs, file.SyncLog)
+		if got, err := load(t, fm, blk0); err != nil || got != 1 {
+			t.Errorf("fm.Load(blk0)=%d, %v, want the synced 1", got, err)
+		}
+		if n, err := fm.Length("testfile"); err != nil || n != 1 {
+			t.Errorf("fm.Length()=%d, %v, want 1", n, err)
+		}
+		// the unsynced block of a created file is lost, and so is the file itself
+		// unless its directory was synced, which the manager does when it creates the file
+		if n, err := fm.Length("otherfile"); err != nil || n != 0 {
+			t.Errorf("fm.Length(otherfile)=%d, %v, want 0", n, err)
+		}
+	})
+
+	t.Run("failed sync is retried", func(t *testing.T) {
+		t.Parallel()
+
+		vfs := file.NewFaultVFS(file.NewMemVFS())
+		fm := open(t, vfs, file.SyncLog)
+		save(t, fm, blk0, 1)
+		save(t, fm, file.NewBlockID("otherfile", 0), 2)
+
+		vfs.FailSyncs("testfile")
+		if err := fm.Sync("testfile"); !errors.Is(err, syscall.EIO) {
+			t.Fatalf("fm.Sync: got %v, want EIO", err)
+		}
+		// the next sync, for any file, syncs the file that failed
+		vfs.ClearFaults()
+		if err := fm.Sync("otherfile"); err != nil {
+			t.Fatalf("fm.Sync: %v", err)
+		}
+
+		if err := vfs.Crash(); err != nil {
+			t.Fatalf("vfs.Crash: %v", err)
+		}
+		fm = open(t, vfs, file.SyncLog)
+		if got, err := load(t, fm, blk0); err != nil || got != 1 {
+			t.Errorf("fm.Load(blk0)=%d, %v, want the synced 1", got, err)
+		}
+	})
+
+	t.Run("crash keeps synced writes", func(t *testing.T) {
+		t.Parallel()
+
+		vfs := file.NewFaultVFS(file.NewMemVFS())
+		fm := open(t, vfs, file.SyncAlways)
+		save(t, fm, blk0, 1)
+		save(t, fm, blk1, 2)
+
+		if err := vfs.Crash(); err != nil {
+			t.Fatalf("vfs.Crash: %v", err)
+		}
+		fm = open(t, vfs, file.SyncAlways)
+		for blk, want := range map[file.BlockID]int32{blk0: 1, blk1: 2} {
+			if got, err := load(t, fm, blk); err != nil || got != want {
+				t.Errorf("fm.Load(%v)=%d, %v, want %d", blk, got, err, want)
+			}
+		}
+	})
+
+	t.Run("crash without syncing the directory", func(t *testing.T) {
+		t.Parallel()
+
+		vfs := file.NewFaultVFS(file.NewMemVFS())
+		fm := open(t, vfs, file.SyncNone)
+		save(t, fm, blk0, 1)
+
+		if err := vfs.Crash(); err != nil {
+			t.Fatalf("vfs.Crash: %v", err)
+		}
+		if exists, err := vfs.Exists("faulttest/testfile"); err != nil || exists {
+			t.Errorf("vfs.Exists()=%v, %v, want the file to be lost", exists, err)
+		}
+	})
+
+	t.Run("torn page", func(t *testing.T) {
+		t.Parallel()
+
+		vfs := file.NewFaultVFS(file.NewMemVFS())
+		fm := open(t, vfs, file.SyncLog)
+		save(t, fm, blk0, 1)
+		if err := fm.Sync("testfile"); err != nil {
+			t.Fatalf("fm.Sync: %v", err)
+		}
+		save(t, fm, blk0, 2)
+
+		vfs.TearWrites(blk0)
+		if err := vfs.Crash(); err != nil {
+			t.Fatalf("vfs.Crash: %v", err)
+		}
+		fm = open(t, vfs, file.SyncLog)
+		if _, err := load(t, fm, blk0); !errors.Is(err, file.ErrCorruptBlock) {
+			t.Errorf("fm.Load of a torn page: got %v, want ErrCorruptBlock", err)
+		}
+	})
+}
+
+func TestManagerControl(t *testing.T) {
+	t.Parallel()
+
+	vfs := file.NewMemVFS()
+	fm, err := file.NewManager("ctltest", 400, file.WithVFS(vfs), file.WithChecksums())
+	if err != nil {
+		t.Fatalf("file.NewManager: %v", err)
+	}
+	c := fm.Control()
+	if c.Version != file.FormatVersion || c.BlockSize != 400 || !c.Checksums || c.CreatedAt.IsZero() {
+		t.Errorf("fm.Control()=%+v, want version %d, block size 400 and checksums", c, file.FormatVersion)
+	}
+
+	// reopening with the same settings reads the same control
+	fm, err = file.NewManager("ctltest", 400, file.WithVFS(vfs), file.WithChecksums())
+	if err != nil {
+		t.Fatalf("file.NewManager: %v", err)
+	}
+	if got := fm.Control(); !got.CreatedAt.Equal(c.CreatedAt) || got.BlockSize != c.BlockSize {
+		t.Errorf("fm.Control()=%+v after reopening, want %+v", got, c)
+	}
+	// the control file is not a file of blocks
+	if corrupt, err := fm.Scrub(); err != nil || len(corrupt) != 0 {
+		t.Errorf("fm.Scrub()=%v, %v, want no corrupt block", corrupt, err)
+	}
+
+	tests := []struct {
+		name      string
+		blockSize int32
+		opts      []file.Option
+		setting   string
+	}{
+		{name: "block size", blockSize: 800, opts: []file.Option{file.WithChecksums()}, setting: "block size"},
+		{name: "checksums", blockSize: 400, setting: "checksums"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := file.NewManager("ctltest", tt.blockSize, append(tt.opts, file.WithVFS(vfs))...)
+			var incompatible *file.IncompatibleError
+			if !errors.As(err, &incompatible) || !errors.Is(err, file.ErrIncompatible) {
+				t.Fatalf("file.NewManager: got %v, want IncompatibleError", err)
+			}
+			if incompatible.Setting != tt.setting {
+				t.Errorf("Setting=%q, want %q", incompatible.Setting, tt.setting)
+			}
+		})
+	}
+
+	t.Run("not a database", func(t *testing.T) {
+		f, err := vfs.OpenFile("ctltest/" + file.ControlFile)
+		if err != nil {
+			t.Fatalf("vfs.OpenFile: %v", err)
+		}
+		if _, err := f.WriteAt([]byte("NOTADB"), 0); err != nil {
+			t.Fatalf("f.WriteAt: %v", err)
+		}
+		if _, err := file.NewManager("ctltest", 400, file.WithVFS(vfs), file.WithChecksums()); !errors.Is(err, file.ErrNotDatabase) {
+			t.Errorf("file.NewManager: got %v, want ErrNotDatabase", err)
+		}
+	})
+}
+
+func TestManagerControlUpgrade(t *testing.T) {
+	t.Parallel()
+
+	// a database created before the control file existed
+	vfs := file.NewMemVFS()
+	if err := vfs.MkdirAll("legacy"); err != nil {
+		t.Fatalf("vfs.MkdirAll: %v", err)
+	}
+	f, err := vfs.OpenFile("legacy/testfile")
+	if err != nil {
+		t.Fatalf("vfs.OpenFile: %v", err)
+	}
+	p := file.NewPage(400)
+	p.SetInt(0, 42)
+	if _, err := f.WriteAt(p.Buffer, 0); err != nil {
+		t.Fatalf("f.WriteAt: %v", err)
+	}
+
+	// the format it is opened with is verified against the files before it is recorded
+	for _, tt := range []struct {
+		blockSize int32
+		opts      []file.Option
+	}{
+		{blockSize: 256},
+		{blockSize: 400, opts: []file.Option{file.WithChecksums()}},
+		{blockSize: 400, opts: []file.Option{file.WithEncryptionKey(bytes.Repeat([]byte{1}, 16))}},
+	} {
+		if _, err := file.NewManager("legacy", tt.blockSize, append(tt.opts, file.WithVFS(vfs))...); !errors.Is(err, file.ErrIncompatible) {
+			t.Errorf("file.NewManager(%d): got %v, want ErrIncompatible", tt.blockSize, err)
+		}
+	}
+	if exists, err := vfs.Exists("legacy/" + file.ControlFile); err != nil || exists {
+		t.Errorf("vfs.Exists()=%v, %v, want no control file written", exists, err)
+	}
+
+	// a temporary file half-written by a previous run is removed, rather than checked against the format
+	tf, err := vfs.OpenFile("legacy/simpledb-temp1.tbl")
+	if err != nil {
+		t.Fatalf("vfs.OpenFile: %v", err)
+	}
+	if _, err := tf.WriteAt(p.Buffer[:100], 0); err != nil {
+		t.Fatalf("tf.WriteAt: %v", err)
+	}
+	fm, err := file.NewManager("legacy", 400, file.WithVFS(vfs))
+	if err != nil {
+		t.Fatalf("file.NewManager: %v", err)
+	}
+	if exists, err := vfs.Exists("legacy/simpledb-temp1.tbl"); err != nil || exists {
+		t.Errorf("vfs.Exists()=%v, %v, want the temporary file removed", exists, err)
+	}
+	if c := fm.Control(); c.Version != file.FormatVersion || c.BlockSize != 400 {
+		t.Errorf("fm.Control()=%+v, want version %d and block size 400", c, file.FormatVersion)
+	}
+	if err := fm.Load(file.NewBlockID("testfile", 0), p); err != nil || p.GetInt(0) != 42 {
+		t.Errorf("fm.Load()=%d, %v, want 42", p.GetInt(0), err)
+	}
+	// the upgraded database records its block size
+	if _, err := file.NewManager("legacy", 800, file.WithVFS(vfs)); !errors.Is(err, file.ErrIncompatible) {
+		t.Errorf("file.NewManager: got %v, want ErrIncompatible", err)
+	}
+}
+
+func TestManagerEncryption(t *testing.T) {
+	t.Parallel()
+
+	key := bytes.Repeat([]byte{1}, 32)
+	vfs := file.NewMemVFS()
+	fm, err := file.NewManager("enctest", 400, file.WithVFS(vfs), file.WithEncryptionKey(key))
+	if err != nil {
+		t.Fatalf("file.NewManager: %v", err)
+	}
+	if c := fm.Control(); !c.Encrypted || c.KeyID != file.KeyIDOf(key) {
+		t.Errorf("fm.Control()=%+v, want encrypted with key %v", c, file.KeyIDOf(key))
+	}
+
+	p := file.NewPage(400)
+	p.SetString(0, "secret")
+	blk0, blk1 := file.NewBlockID("testfile", 0), file.NewBlockID("testfile", 1)
+	readRaw := func(t *testing.T) []byte {
+		t.Helper()
+		f, err := vfs.OpenFile("enctest/testfile")
+		if err != nil {
+			t.Fatalf("vfs.OpenFile: %v", err)
+		}
+		size, err := f.Size()
+		if err != nil {
+			t.Fatalf("f.Size: %v", err)
+		}
+		b := make([]byte, size)
+		if _, err := f.ReadAt(b, 0); err != nil {
+			t.Fatalf("f.ReadAt: %v", err)
+		}
+		return b
+	}
+	if err := fm.Save(blk0, p); err != nil {
+		t.Fatalf("fm.Save: %v", err)
+	}
+	first := readRaw(t)
+	if bytes.Contains(first, p.Buffer[:16]) {
+		t.Errorf("the page is stored in plaintext")
+	}
+	// writing the same page again does not reuse the nonce
+	if err := fm.Save(blk0, p); err != nil {
+		t.Fatalf("fm.Save: %v", err)
+	}
+	if bytes.Equal(first, readRaw(t)) {
+		t.Errorf("the same page is encrypted to the same bytes twice")
+	}
+	got := file.NewPage(400)
+	if err := fm.Load(blk0, got); err != nil || got.GetString(0) != "secret" {
+		t.Errorf("fm.Load()=%q, %v, want secret", got.GetString(0), err)
+	}
+
+	// a block copied to another place does not decrypt
+	f, err := vfs.OpenFile("enctest/testfile")
+	if err != nil {
+		t.Fatalf("vfs.OpenFile: %v", err)
+	}
+	if _, err := f.WriteAt(readRaw(t), int64(len(first))); err != nil {
+		t.Fatalf("f.WriteAt: %v", err)
+	}
+	if err := fm.Load(blk1, got); !errors.Is(err, file.ErrCorruptBlock) {
+		t.Errorf("fm.Load of a copied block: got %v, want ErrCorruptBlock", err)
+	}
+	if corrupt, err := fm.Scrub(); err != nil || len(corrupt) != 1 || corrupt[0].Block != blk1 {
+		t.Errorf("fm.Scrub()=%v, %v, want %v", corrupt, err, blk1)
+	}
+
+	tests := []struct {
+		name string
+		opts []file.Option
+		want error
+	}{
+		{name: "wrong key", opts: []file.Option{file.WithEncryptionKey(bytes.Repeat([]byte{2}, 32))}, want: file.ErrIncompatible},
+		{name: "no key", want: file.ErrIncompatible},
+		{name: "invalid key", opts: []file.Option{file.WithEncryptionKey([]byte("short"))}, want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := file.NewManager("enctest", 400, append(tt.opts, file.WithVFS(vfs))...)
+			if err == nil || tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("file.NewManager: got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRotateKey(t *testing.T) {
+	t.Parallel()
+
+	oldKey, newKey := bytes.Repeat([]byte{1}, 16), bytes.Repeat([]byte{2}, 32)
+	blk := file.NewBlockID("testfile", 1)
+	vfs := file.NewFaultVFS(file.NewMemVFS())
+	fm, err := file.NewManager("rotatetest", 400, file.WithVFS(vfs), file.WithEncryptionKey(oldKey))
+	if err != nil {
+		t.Fatalf("file.NewManager: %v", err)
+	}
+	p := file.NewPage(400)
+	for i := range int32(3) {
+		p.SetInt(0, i)
+		if err := fm.Save(file.NewBlockID("testfile", i), p); err != nil {
+			t.Fatalf("fm.Save: %v", err)
+		}
+	}
+
+	// the rotation stops at the second block, and the database cannot be opened until it is completed
+	vfs.FailWrites(blk)
+	if err := file.RotateKey("rotatetest", oldKey, newKey, file.WithVFS(vfs)); !errors.Is(err, syscall.EIO) {
+		t.Fatalf("file.RotateKey: got %v, want EIO", err)
+	}
+	for _, key := range [][]byte{oldKey, newKey} {
+		if _, err := file.NewManager("rotatetest", 400, file.WithVFS(vfs), file.WithEncryptionKey(key)); !errors.Is(err, file.ErrKeyRotation) {
+			t.Errorf("file.NewManager: got %v, want ErrKeyRotation", err)
+		}
+	}
+	vfs.ClearFaults()
+	if err := file.RotateKey("rotatetest", oldKey, newKey, file.WithVFS(vfs)); err != nil {
+		t.Fatalf("file.RotateKey: %v", err)
+	}
+
+	if _, err := file.NewManager("rotatetest", 400, file.WithVFS(vfs), file.WithEncryptionKey(oldKey)); !errors.Is(err, file.ErrIncompatible) {
+		t.Errorf("file.NewManager with the old key: got %v, want ErrIncompatible", err)
+	}
+	fm, err = file.NewManager("rotatetest", 400, file.WithVFS(vfs), file.WithEncryptionKey(newKey))
+	if err != nil {
+		t.Fatalf("file.NewManager: %v", err)
+	}
+	if c := fm.Control(); c.KeyID != file.KeyIDOf(newKey) || c.PrevKeyID != (file.KeyID{}) {
+		t.Errorf("fm.Control()=%+v, want key %v", c, file.KeyIDOf(newKey))
+	}
+	for i := range int32(3) {
+		if err := fm.Load(file.NewBlockID("testfile", i), p); err != nil || p.GetInt(0) != i {
+			t.Errorf("fm.Load(%d)=%d, %v, want %d", i, p.GetInt(0), err, i)
+		}
+	}
+
+	if err := file.RotateKey("nodb", oldKey, newKey, file.WithVFS(vfs)); err == nil {
+		t.Errorf("file.RotateKey of a missing database succeeded")
+	}
+}
+
+func TestRotateKeyTornWrite(t *testing.T) {
+	t.Parallel()
+
+	oldKey, newKey := bytes.Repeat([]byte{1}, 16), bytes.Repeat([]byte{2}, 16)
+	vfs := file.NewFaultVFS(file.NewMemVFS())
+	fm, err := file.NewManager("tornrotatetest", 400, file.WithVFS(vfs), file.WithEncryptionKey(oldKey))
+	if err != nil {
+		t.Fatalf("file.NewManager: %v", err)
+	}
+	p := file.NewPage(400)
+	for i := range int32(3) {
+		p.SetInt(0, i)
+		if err := fm.Save(file.NewBlockID("testfile", i), p); err != nil {
+			t.Fatalf("fm.Save: %v", err)
+		}
+	}
+
+	if err := file.RotateKey("tornrotatetest", oldKey, oldKey, file.WithVFS(vfs)); err == nil {
+		t.Errorf("file.RotateKey with the same key succeeded")
+	}
+
+	// a crash tears the blocks rewritten in place, which are restored from the journal when the rotation is resumed
+	vfs.FailSyncs("testfile")
+	vfs.TearWrites(file.NewBlockID("testfile", 0))
+	if err := file.RotateKey("tornrotatetest", oldKey, newKey, file.WithVFS(vfs)); !errors.Is(err, syscall.EIO) {
+		t.Fatalf("file.RotateKey: got %v, want EIO", err)
+	}
+	if err := vfs.Crash(); err != nil {
+		t.Fatalf("vfs.Crash: %v", err)
+	}
+	vfs.ClearFaults()
+	if err := file.RotateKey("tornrotatetest", oldKey, newKey, file.WithVFS(vfs)); err != nil {
+		t.Fatalf("file.RotateKey: %v", err)
+	}
+
+	fm, err = file.NewManager("tornrotatetest", 400, file.WithVFS(vfs), file.WithEncryptionKey(newKey))
+	if err != nil {
+		t.Fatalf("file.NewManager: %v", err)
+	}
+	for i := range int32(3) {
+		if err := fm.Load(file.NewBlockID("testfile", i), p); err != nil || p.GetInt(0) != i {
+			t.Errorf("fm.Load(%d)=%d, %v, want %d", i, p.GetInt(0), err, i)
+		}
+	}
+	if names, err := vfs.ReadDir("tornrotatetest"); err != nil || slices.Contains(names, "simpledb.rotation") {
+		t.Errorf("vfs.ReadDir=%v, %v, want no journal", names, err)
+	}
+}
+
+func TestSimpleDBWithEncryption(t *testing.T) {
+	t.Parallel()
+
+	dbDir := path.Join(t.TempDir(), "encdbtest")
+	keys := [][]byte{bytes.Repeat([]byte{1}, 32), bytes.Repeat([]byte{2}, 32)}
+	blk := file.NewBlockID("testfile", 0)
+	for i, key := range keys {
+		// the block size and the checksums are read by RotateKey from the control file
+		db, err := server.NewSimpleDB(dbDir, 512, 8, server.WithFileOptions(file.WithEncryptionKey(key), file.WithChecksums()))
+		if err != nil {
+			t.Fatalf("server.NewSimpleDB: %v", err)
+		}
+		tx := db.NewTx()
+		if err := tx.Recover(); err != nil {
+			t.Fatalf("tx.Recover: %v", err)
+		}
+		if err := tx.Pin(blk); err != nil {
+			t.Fatalf("tx.Pin: %v", err)
+		}
+		got, err := tx.GetInt(blk, 80)
+		if err != nil {
+			t.Fatalf("tx.GetInt: %v", err)
+		}
+		if got != int32(i) {
+			t.Errorf("value=%d, want %d", got, i)
+		}
+		if err := tx.SetInt(blk, 80, int32(i+1), true); err != nil {
+			t.Fatalf("tx.SetInt: %v", err)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatalf("tx.Commit: %v", err)
+		}
+		if err := db.Close(); err != nil {
+			t.Fatalf("db.Close: %v", err)
+		}
+
+		if i+1 < len(keys) {
+			if err := file.RotateKey(dbDir, key, keys[i+1]); err != nil {
+				t.Fatalf("file.RotateKey: %v", err)
+			}
+		}
+	}
+}
+
+func TestManagerTempFiles(t *testing.T) {
+	t.Parallel()
+
+	// the files left by a previous run
+	dbDir := path.Join(t.TempDir(), "temptest")
+	if _, err := file.NewManager(dbDir, 400); err != nil {
+		t.Fatalf("file.NewManager: %v", err)
+	}
+	// a table may be named like a temporary file of another system, such as temp1
+	for _, name := range []string{"simpledb-temp3", "simpledb-temp3.tbl", "temp1.tbl", "temperature.tbl", "student.tbl"} {
+		if err := os.WriteFile(path.Join(dbDir, name), nil, 0o644); err != nil {
+			t.Fatalf("os.WriteFile: %v", err)
+		}
+	}
+	fm, err := file.NewManager(dbDir, 400)
+	if err != nil {
+		t.Fatalf("file.NewManager: %v", err)
+	}
+	listFiles := func(t *testing.T) []string {
+		t.Helper()
+		entries, err := os.ReadDir(dbDir)
+		if err != nil {
+			t.Fatalf("os.ReadDir: %v", err)
+		}
+		var names []string
+		for _, e := range entries {
+			if e.Name() != file.ControlFile {
+				names = append(names, e.Name())
+			}
+		}
+		return names
+	}
+	if got, want := listFiles(t), []string{"student.tbl", "temp1.tbl", "temperature.tbl"}; !slices.Equal(got, want) {
+		t.Errorf("files after startup=%v, want %v", got, want)
+	}
+
+	temp1, temp2 := fm.NextTempFileName(), fm.NextTempFileName()
+	if temp1 == temp2 {
+		t.Fatalf("fm.NextTempFileName returned %s twice", temp1)
+	}
+	for _, name := range []string{temp1, temp2, temp2 + ".tbl"} {
+		if _, err := fm.Extend(name); err != nil {
+			t.Fatalf("fm.Extend: %v", err)
+		}
+	}
+	if got := fm.TempFiles(); len(got) != 2 {
+		t.Errorf("fm.TempFiles()=%v, want 2 files", got)
+	}
+
+	if err := fm.RemoveTempFile(temp2); err != nil {
+		t.Fatalf("fm.RemoveTempFile: %v", err)
+	}
+	if err := fm.RemoveTempFile(temp2); err == nil {
+		t.Errorf("fm.RemoveTempFile of a removed file succeeded")
+	}
+	if got, want := listFiles(t), []string{temp1, "student.tbl", "temp1.tbl", "temperature.tbl"}; !slices.Equal(got, want) {
+		t.Errorf("files after fm.RemoveTempFile=%v, want %v", got, want)
+	}
+
+	// the files in flight are removed by Close
+	if err := fm.Close(); err != nil {
+		t.Fatalf("fm.Close: %v", err)
+	}
+	if got, want := listFiles(t), []string{"student.tbl", "temp1.tbl", "temperature.tbl"}; !slices.Equal(got, want) {
+		t.Errorf("files after fm.Close=%v, want %v", got, want)
+	}
+	if got := fm.TempFiles(); len(got) != 0 {
+		t.Errorf("fm.TempFiles()=%v after fm.Close, want none", got)
+	}
+}
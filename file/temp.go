@@ -0,0 +1,111 @@
+package file
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// tempPrefix starts the names of the temporary files, which are followed by a number and optionally an extension.
+// It is not a valid identifier, so that the file of a table is never taken for a temporary file.
+const tempPrefix = "simpledb-temp"
+
+// isTempFile reports whether the file was created by NextTempFileName, possibly with an extension added,
+// e.g. simpledb-temp12.tbl.
+func isTempFile(name string) bool {
+	num, ok := strings.CutPrefix(name, tempPrefix)
+	if !ok {
+		return false
+	}
+	num, _, _ = strings.Cut(num, ".")
+	_, err := strconv.ParseUint(num, 10, 64)
+	return err == nil
+}
+
+// NextTempFileName returns the name of a new temporary file, e.g. for a table materializing an intermediate result.
+// The file is in flight until it is released by RemoveTempFile, and is removed by Close if it is still in flight;
+// the temporary files left by a crash are removed when the next Manager of DbDir is created.
+// The name may be extended with a suffix such as ".tbl", and all the files whose names start with it are temporary.
+func (fm *Manager) NextTempFileName() string {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+
+	fm.lastTemp++
+	name := tempPrefix + strconv.FormatUint(fm.lastTemp, 10)
+	fm.temps[name] = true
+	return name
+}
+
+// TempFiles returns the names of the temporary files in flight, in no particular order.
+func (fm *Manager) TempFiles() []string {
+	fm.mu.RLock()
+	defer fm.mu.RUnlock()
+
+	names := make([]string, 0, len(fm.temps))
+	for name := range fm.temps {
+		names = append(names, name)
+	}
+	return names
+}
+
+// RemoveTempFile removes the files of the temporary file returned by NextTempFileName, and releases its name.
+// The caller must not use the files anymore.
+func (fm *Manager) RemoveTempFile(name string) error {
+	fm.mu.Lock()
+	inFlight := fm.temps[name]
+	delete(fm.temps, name)
+	fm.mu.Unlock()
+
+	if !inFlight {
+		return fmt.Errorf("%s is not a temporary file in flight", name)
+	}
+	return fm.removeTempFiles(name)
+}
+
+// removeTempFiles closes and removes the files of the temporary file, which may not exist.
+// Only the open files are looked up under mu, so that the other files can be opened meanwhile.
+func (fm *Manager) removeTempFiles(temp string) error {
+	names, err := fm.vfs.ReadDir(fm.DbDir)
+	if err != nil {
+		return fmt.Errorf("vfs.ReadDir: %w", err)
+	}
+	var errs []error
+	for _, name := range names {
+		if name != temp && !strings.HasPrefix(name, temp+".") {
+			continue
+		}
+		fm.mu.Lock()
+		f, ok := fm.files[name]
+		delete(fm.files, name)
+		delete(fm.unsynced, name)
+		fm.mu.Unlock()
+		if ok {
+			if err := f.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("f.Close: %w", err))
+			}
+		}
+		if err := fm.vfs.Remove(path.Join(fm.DbDir, name)); err != nil {
+			errs = append(errs, fmt.Errorf("vfs.Remove: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// removeLeftoverTempFiles removes the temporary files left in DbDir by a previous Manager.
+func (fm *Manager) removeLeftoverTempFiles() error {
+	names, err := fm.vfs.ReadDir(fm.DbDir)
+	if err != nil {
+		return fmt.Errorf("vfs.ReadDir: %w", err)
+	}
+	for _, name := range names {
+		if !isTempFile(name) {
+			continue
+		}
+		if err := fm.vfs.Remove(path.Join(fm.DbDir, name)); err != nil {
+			return fmt.Errorf("vfs.Remove: %w", err)
+		}
+	}
+	return nil
+}
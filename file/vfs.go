@@ -0,0 +1,115 @@
+package file
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+)
+
+// VFS is the file system holding the files of a Manager. Names are paths, as in the os package.
+type VFS interface {
+	// OpenFile opens the file for reading and writing, creating it if it does not exist.
+	OpenFile(name string) (VFile, error)
+	// Exists reports whether the file or directory exists.
+	Exists(name string) (bool, error)
+	// MkdirAll creates the directory and its missing parents.
+	MkdirAll(dir string) error
+	// ReadDir returns the names of the regular files in the directory, sorted.
+	ReadDir(dir string) ([]string, error)
+	Remove(name string) error
+	// SyncDir makes the creation and removal of the files in the directory durable.
+	SyncDir(dir string) error
+}
+
+// VFile is a file opened by a VFS. It is safe for concurrent use.
+type VFile interface {
+	io.ReaderAt
+	io.WriterAt
+	Size() (int64, error)
+	Truncate(size int64) error
+	// Sync makes the writes to the file durable.
+	Sync() error
+	Close() error
+}
+
+// WithVFS sets the file system holding the files. The default is NewOSVFS().
+func WithVFS(vfs VFS) Option {
+	return func(fm *Manager) {
+		fm.vfs = vfs
+	}
+}
+
+type osVFS struct{}
+
+// NewOSVFS returns the file system of the operating system.
+func NewOSVFS() VFS {
+	return osVFS{}
+}
+
+func (osVFS) OpenFile(name string) (VFile, error) {
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("os.OpenFile: %w", err)
+	}
+	return osFile{f}, nil
+}
+
+func (osVFS) Exists(name string) (bool, error) {
+	_, err := os.Stat(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("os.Stat: %w", err)
+	}
+	return true, nil
+}
+
+func (osVFS) MkdirAll(dir string) error {
+	return os.MkdirAll(dir, 0o700)
+}
+
+func (osVFS) ReadDir(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("os.ReadDir: %w", err)
+	}
+	var names []string
+	for _, entry := range entries {
+		if entry.Type().IsRegular() {
+			names = append(names, entry.Name())
+		}
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+func (osVFS) Remove(name string) error {
+	return os.Remove(name)
+}
+
+func (osVFS) SyncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("os.Open: %w", err)
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("d.Sync: %w", err)
+	}
+	return nil
+}
+
+type osFile struct {
+	*os.File
+}
+
+func (f osFile) Size() (int64, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("f.Stat: %w", err)
+	}
+	return fi.Size(), nil
+}
@@ -0,0 +1,294 @@
+package file
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"sync"
+	"syscall"
+)
+
+// FaultVFS wraps a VFS to inject faults into the blocks of its files, for crash and I/O error tests.
+// It remembers the writes made since each file was last synced, so that Crash can drop them as a power loss would.
+// The blocks are located with the size of the blocks on disk, which is larger than BlockSize with checksums or encryption,
+// and is set by the Manager using the FaultVFS.
+type FaultVFS struct {
+	base VFS
+
+	mu            sync.Mutex // serializes every operation, so that the remembered writes are consistent
+	diskBlockSize int64
+	readErrs      map[BlockID]bool
+	writeErrs     map[BlockID]bool
+	torn          map[BlockID]bool
+	syncErrs      map[string]bool    // the base names of the files failing to sync
+	durable       map[string][]byte  // the contents at the last sync, of the files written since
+	written       map[string][]write // the writes since the last sync
+	created       map[string]bool    // the files created since their directory was last synced
+}
+
+type write struct {
+	off  int64
+	data []byte
+}
+
+// NewFaultVFS returns a FaultVFS over base, which injects no fault until told to.
+func NewFaultVFS(base VFS) *FaultVFS {
+	return &FaultVFS{
+		base:      base,
+		readErrs:  make(map[BlockID]bool),
+		writeErrs: make(map[BlockID]bool),
+		torn:      make(map[BlockID]bool),
+		syncErrs:  make(map[string]bool),
+		durable:   make(map[string][]byte),
+		written:   make(map[string][]write),
+		created:   make(map[string]bool),
+	}
+}
+
+// setDiskBlockSize is called by NewManager with the size of its blocks on disk.
+func (v *FaultVFS) setDiskBlockSize(size int) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.diskBlockSize = int64(size)
+}
+
+// FailReads makes the reads of the block fail with EIO.
+func (v *FaultVFS) FailReads(blk BlockID) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.readErrs[blk] = true
+}
+
+// FailWrites makes the writes of the block fail with EIO.
+func (v *FaultVFS) FailWrites(blk BlockID) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.writeErrs[blk] = true
+}
+
+// FailSyncs makes the syncs of the file, named as in a BlockID, fail with EIO.
+func (v *FaultVFS) FailSyncs(filename string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.syncErrs[filename] = true
+}
+
+// TearWrites makes Crash keep only the first half of the unsynced writes of the block, as a torn page.
+func (v *FaultVFS) TearWrites(blk BlockID) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.torn[blk] = true
+}
+
+// ClearFaults stops injecting faults.
+func (v *FaultVFS) ClearFaults() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	clear(v.readErrs)
+	clear(v.writeErrs)
+	clear(v.torn)
+	clear(v.syncErrs)
+}
+
+// Crash simulates a power loss: the writes since the last sync of each file are dropped, except the torn halves,
+// and so are the files created since their directory was last synced.
+// The files opened before must not be used anymore.
+func (v *FaultVFS) Crash() error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	for name := range v.created {
+		if err := v.base.Remove(name); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("base.Remove: %w", err)
+		}
+		delete(v.durable, name)
+		delete(v.written, name)
+	}
+	for name, contents := range v.durable {
+		if err := v.restore(name, contents); err != nil {
+			return fmt.Errorf("v.restore: %w", err)
+		}
+	}
+	clear(v.created)
+	clear(v.durable)
+	clear(v.written)
+	return nil
+}
+
+func (v *FaultVFS) restore(name string, contents []byte) error {
+	f, err := v.base.OpenFile(name)
+	if err != nil {
+		return fmt.Errorf("base.OpenFile: %w", err)
+	}
+	defer f.Close()
+
+	if err := f.Truncate(int64(len(contents))); err != nil {
+		return fmt.Errorf("f.Truncate: %w", err)
+	}
+	if _, err := f.WriteAt(contents, 0); err != nil {
+		return fmt.Errorf("f.WriteAt: %w", err)
+	}
+	for _, w := range v.written[name] {
+		if v.diskBlockSize > 0 && v.torn[v.blockOf(name, w.off)] {
+			if _, err := f.WriteAt(w.data[:len(w.data)/2], w.off); err != nil {
+				return fmt.Errorf("f.WriteAt: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+func (v *FaultVFS) blockOf(name string, off int64) BlockID {
+	return NewBlockID(path.Base(name), int32(off/v.diskBlockSize))
+}
+
+// check returns EIO if a block in the range is in errs.
+func (v *FaultVFS) check(errs map[BlockID]bool, op, name string, off int64, n int) error {
+	if v.diskBlockSize == 0 {
+		return nil // not used by a Manager yet
+	}
+	for o := off - off%v.diskBlockSize; o < off+int64(n); o += v.diskBlockSize {
+		if errs[v.blockOf(name, o)] {
+			return &os.PathError{Op: op, Path: name, Err: syscall.EIO}
+		}
+	}
+	return nil
+}
+
+// remember keeps the contents of the file at its last sync, before it is first modified since.
+func (v *FaultVFS) remember(name string, f VFile) error {
+	if _, ok := v.durable[name]; ok {
+		return nil
+	}
+	size, err := f.Size()
+	if err != nil {
+		return fmt.Errorf("f.Size: %w", err)
+	}
+	contents := make([]byte, size)
+	if _, err := f.ReadAt(contents, 0); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("f.ReadAt: %w", err)
+	}
+	v.durable[name] = contents
+	return nil
+}
+
+func (v *FaultVFS) OpenFile(name string) (VFile, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	exists, err := v.base.Exists(name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := v.base.OpenFile(name)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		v.created[name] = true
+	}
+	return &faultFile{vfs: v, name: name, base: f}, nil
+}
+
+func (v *FaultVFS) Exists(name string) (bool, error) {
+	return v.base.Exists(name)
+}
+
+func (v *FaultVFS) MkdirAll(dir string) error {
+	return v.base.MkdirAll(dir)
+}
+
+func (v *FaultVFS) ReadDir(dir string) ([]string, error) {
+	return v.base.ReadDir(dir)
+}
+
+func (v *FaultVFS) Remove(name string) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	delete(v.created, name)
+	delete(v.durable, name)
+	delete(v.written, name)
+	return v.base.Remove(name)
+}
+
+func (v *FaultVFS) SyncDir(dir string) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if err := v.base.SyncDir(dir); err != nil {
+		return err
+	}
+	for name := range v.created {
+		if path.Dir(name) == path.Clean(dir) {
+			delete(v.created, name)
+		}
+	}
+	return nil
+}
+
+type faultFile struct {
+	vfs  *FaultVFS
+	name string
+	base VFile
+}
+
+func (f *faultFile) ReadAt(p []byte, off int64) (int, error) {
+	f.vfs.mu.Lock()
+	defer f.vfs.mu.Unlock()
+
+	if err := f.vfs.check(f.vfs.readErrs, "read", f.name, off, len(p)); err != nil {
+		return 0, err
+	}
+	return f.base.ReadAt(p, off)
+}
+
+func (f *faultFile) WriteAt(p []byte, off int64) (int, error) {
+	f.vfs.mu.Lock()
+	defer f.vfs.mu.Unlock()
+
+	if err := f.vfs.check(f.vfs.writeErrs, "write", f.name, off, len(p)); err != nil {
+		return 0, err
+	}
+	if err := f.vfs.remember(f.name, f.base); err != nil {
+		return 0, err
+	}
+	f.vfs.written[f.name] = append(f.vfs.written[f.name], write{off: off, data: slices.Clone(p)})
+	return f.base.WriteAt(p, off)
+}
+
+func (f *faultFile) Size() (int64, error) {
+	return f.base.Size()
+}
+
+func (f *faultFile) Truncate(size int64) error {
+	f.vfs.mu.Lock()
+	defer f.vfs.mu.Unlock()
+
+	if err := f.vfs.remember(f.name, f.base); err != nil {
+		return err
+	}
+	return f.base.Truncate(size)
+}
+
+func (f *faultFile) Sync() error {
+	f.vfs.mu.Lock()
+	defer f.vfs.mu.Unlock()
+
+	if f.vfs.syncErrs[path.Base(f.name)] {
+		return &os.PathError{Op: "sync", Path: f.name, Err: syscall.EIO}
+	}
+	if err := f.base.Sync(); err != nil {
+		return err
+	}
+	delete(f.vfs.durable, f.name)
+	delete(f.vfs.written, f.name)
+	return nil
+}
+
+func (f *faultFile) Close() error {
+	return f.base.Close()
+}
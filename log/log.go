@@ -3,14 +3,17 @@ package log
 import (
 	"ddai-go/file"
 	"fmt"
+	"sync"
 )
 
+// LogIterator reads the log records from the most recent one to the oldest one.
 type LogIterator struct {
 	fileManager *file.Manager
 	blk         file.BlockID
 	page        *file.Page
 	currentPos  int32
 	boundary    int32
+	lsn         int32
 }
 
 func NewIterator(fm *file.Manager, blk file.BlockID) (*LogIterator, error) {
@@ -53,13 +56,24 @@ func (it *LogIterator) Next() ([]byte, error) {
 			return nil, err
 		}
 	}
-	rec := it.page.GetBytes(it.currentPos)
-	it.currentPos += file.Int32ByteSize + int32(len(rec))
+	it.lsn = it.page.GetInt(it.currentPos)
+	rec := it.page.GetBytes(it.currentPos + file.Int32ByteSize)
+	it.currentPos += recordHeaderSize + int32(len(rec))
 	return rec, nil
 }
 
+// LSN returns the log sequence number of the record most recently returned by Next.
+func (it *LogIterator) LSN() int32 {
+	return it.lsn
+}
+
+// recordHeaderSize is the size of the LSN and the length that precede each record in a log block.
+const recordHeaderSize = file.Int32ByteSize + file.Int32ByteSize
+
 // Manager responsible for writing log records to the log file,
 // treats the log as just an ever-increasing sequence of log records.
+// Each record is stored with its LSN, so that LSNs keep increasing across restarts.
+// Manager is safe for concurrent use.
 type Manager struct {
 	fileManager  *file.Manager
 	logFile      string
@@ -67,6 +81,7 @@ type Manager struct {
 	currentBlk   file.BlockID
 	latestLSN    int32
 	lastSavedLSN int32
+	mu           sync.Mutex
 }
 
 func NewManager(fileManager *file.Manager, logFile string) (*Manager, error) {
@@ -95,11 +110,34 @@ func NewManager(fileManager *file.Manager, logFile string) (*Manager, error) {
 		if err != nil {
 			return nil, fmt.Errorf("fileManager.Load: %w", err)
 		}
+		lm.latestLSN, err = lm.readLatestLSN()
+		if err != nil {
+			return nil, fmt.Errorf("lm.readLatestLSN: %w", err)
+		}
+		lm.lastSavedLSN = lm.latestLSN
 	}
 
 	return lm, nil
 }
 
+// readLatestLSN returns the LSN of the most recent record on disk, or 0 if the log has no record.
+// The last blocks may be empty, when the log was extended but nothing was appended afterward.
+func (lm *Manager) readLatestLSN() (int32, error) {
+	if boundary := lm.logPage.GetInt(0); boundary < lm.fileManager.BlockSize {
+		return lm.logPage.GetInt(boundary), nil
+	}
+	page := file.NewPage(lm.fileManager.BlockSize)
+	for i := lm.currentBlk.Index - 1; i >= 0; i-- {
+		if err := lm.fileManager.Load(file.NewBlockID(lm.logFile, i), page); err != nil {
+			return 0, fmt.Errorf("fileManager.Load: %w", err)
+		}
+		if boundary := page.GetInt(0); boundary < lm.fileManager.BlockSize {
+			return page.GetInt(boundary), nil
+		}
+	}
+	return 0, nil
+}
+
 func (lm *Manager) extendLogBlock() (file.BlockID, error) {
 	blk, err := lm.fileManager.Extend(lm.logFile)
 	if err != nil {
@@ -114,6 +152,9 @@ func (lm *Manager) extendLogBlock() (file.BlockID, error) {
 }
 
 func (lm *Manager) Flush(lsn int32) error {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
 	if lsn < lm.lastSavedLSN {
 		return nil
 	}
@@ -127,27 +168,35 @@ func (lm *Manager) flush() error {
 	if err := lm.fileManager.Save(lm.currentBlk, lm.logPage); err != nil {
 		return fmt.Errorf("fileManager.Save: %w", err)
 	}
+	if err := lm.fileManager.Sync(lm.logFile); err != nil {
+		return fmt.Errorf("fileManager.Sync: %w", err)
+	}
 	lm.lastSavedLSN = lm.latestLSN
 	return nil
 }
 
 func (lm *Manager) Iterator() (*LogIterator, error) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
 	if err := lm.flush(); err != nil {
 		return nil, fmt.Errorf("lm.flush: %w", err)
 	}
 	return NewIterator(lm.fileManager, lm.currentBlk)
 }
 
-// Append adds a record to the log
+// Append adds a record to the log, and returns its LSN
 func (lm *Manager) Append(rec []byte) (int32, error) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
 	// boundary contains the offset of the most recently added record.
 	// This strategy enables the log iterator to read records in reverse order by reading from left to right.
 	boundary := lm.logPage.GetInt(0)
 	recSize := int32(len(rec))
-	bytesNeeded := recSize + file.Int32ByteSize
+	bytesNeeded := recSize + recordHeaderSize
 
 	if boundary-bytesNeeded < file.Int32ByteSize {
-		fmt.Println("flushing-------")
 		// It doesn't fit, so move to next
 		if err := lm.flush(); err != nil {
 			return 0, fmt.Errorf("lm.flush: %w", err)
@@ -159,11 +208,12 @@ func (lm *Manager) Append(rec []byte) (int32, error) {
 		lm.currentBlk = extendedBlk
 		boundary = lm.logPage.GetInt(0)
 	}
+	lm.latestLSN += 1
+
 	recPos := boundary - bytesNeeded
-	lm.logPage.SetBytes(recPos, rec)
+	lm.logPage.SetInt(recPos, lm.latestLSN)
+	lm.logPage.SetBytes(recPos+file.Int32ByteSize, rec)
 	lm.logPage.SetInt(0, recPos) // the new boundary
 
-	lm.latestLSN += 1
-
 	return lm.latestLSN, nil
 }
@@ -65,7 +65,10 @@ func peekLogRecords(logManager *log.Manager) string {
 	res := ""
 	sentinel := 0
 	for iter.HasNext() {
-		rec := iter.Next()
+		rec, err := iter.Next()
+		if err != nil {
+			panic(err)
+		}
 		p := file.NewPageWith(rec)
 		s := p.GetString(0)
 		npos := file.MaxLength(len(s))
@@ -87,3 +90,54 @@ func genWant(n int) string {
 	}
 	return want
 }
+
+func TestLogLSN(t *testing.T) {
+	t.Parallel()
+
+	dbDir := path.Join(t.TempDir(), "lsntest")
+	wantLSN := int32(0)
+	for range 3 {
+		// reopen the log, whose records are not transaction log records
+		fm, err := file.NewManager(dbDir, 400)
+		if err != nil {
+			t.Fatalf("file.NewManager: %v", err)
+		}
+		lm, err := log.NewManager(fm, "lsntest.log")
+		if err != nil {
+			t.Fatalf("log.NewManager: %v", err)
+		}
+		// enough records to span several blocks
+		for i := range 50 {
+			lsn, err := lm.Append([]byte(strconv.Itoa(i)))
+			if err != nil {
+				t.Fatalf("Append: %v", err)
+			}
+			wantLSN++
+			if lsn != wantLSN {
+				t.Fatalf("lsn=%d, want %d", lsn, wantLSN)
+			}
+		}
+		if err := lm.Flush(wantLSN); err != nil {
+			t.Fatalf("Flush: %v", err)
+		}
+
+		iter, err := lm.Iterator()
+		if err != nil {
+			t.Fatalf("Iterator: %v", err)
+		}
+		for lsn := wantLSN; lsn > 0; lsn-- {
+			if !iter.HasNext() {
+				t.Fatalf("no record of lsn %d", lsn)
+			}
+			if _, err := iter.Next(); err != nil {
+				t.Fatalf("Next: %v", err)
+			}
+			if iter.LSN() != lsn {
+				t.Fatalf("iter.LSN()=%d, want %d", iter.LSN(), lsn)
+			}
+		}
+		if iter.HasNext() {
+			t.Fatalf("unexpected record after lsn 1")
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package metadata
+
+import (
+	"ddai-go/record"
+	"ddai-go/tx"
+	"errors"
+	"fmt"
+)
+
+// IndexInfo describes an index on a field of a table, and estimates the cost of using it.
+type IndexInfo struct {
+	idxname   string
+	fldname   string
+	tblSchema *record.Schema
+	idxLayout *record.Layout
+	blockSize int32
+	si        StatInfo
+}
+
+func NewIndexInfo(idxname string, fldname string, tblSchema *record.Schema, blockSize int32, si StatInfo) *IndexInfo {
+	ii := &IndexInfo{
+		idxname:   idxname,
+		fldname:   fldname,
+		tblSchema: tblSchema,
+		blockSize: blockSize,
+		si:        si,
+	}
+	ii.idxLayout = ii.createIdxLayout()
+	return ii
+}
+
+func (ii *IndexInfo) IndexName() string {
+	return ii.idxname
+}
+
+func (ii *IndexInfo) FieldName() string {
+	return ii.fldname
+}
+
+// Layout returns the layout of the index records: (block, id, dataval).
+func (ii *IndexInfo) Layout() *record.Layout {
+	return ii.idxLayout
+}
+
+// numBuckets is the number of buckets assumed for a static hash index.
+const numBuckets = 100
+
+// BlocksAccessed estimates the number of blocks accessed to search the index,
+// assuming a static hash index whose records are spread evenly over its buckets.
+func (ii *IndexInfo) BlocksAccessed() int32 {
+	rpb := max(ii.blockSize/ii.idxLayout.SlotSize(), 1)
+	numBlocks := ii.si.RecordsOutput() / rpb
+	return numBlocks / numBuckets
+}
+
+// RecordsOutput estimates the number of records having the same search key.
+func (ii *IndexInfo) RecordsOutput() int32 {
+	return ii.si.RecordsOutput() / max(ii.si.DistinctValues(ii.fldname), 1)
+}
+
+func (ii *IndexInfo) DistinctValues(fldname string) int32 {
+	if ii.fldname == fldname {
+		return 1
+	}
+	return ii.si.DistinctValues(fldname)
+}
+
+func (ii *IndexInfo) createIdxLayout() *record.Layout {
+	sch := record.NewSchema()
+	sch.AddIntField("block")
+	sch.AddIntField("id")
+	if ii.tblSchema.Type(ii.fldname) == record.Integer {
+		sch.AddIntField("dataval")
+	} else {
+		sch.AddStringField("dataval", ii.tblSchema.Length(ii.fldname))
+	}
+	return record.NewLayout(sch)
+}
+
+// IndexMgr stores index descriptors in the catalog table idxcat(indexname, tablename, fieldname).
+type IndexMgr struct {
+	layout  *record.Layout
+	tblMgr  *TableMgr
+	statMgr *StatMgr
+}
+
+// NewIndexMgr creates the catalog table if the database is new.
+func NewIndexMgr(isNew bool, tblMgr *TableMgr, statMgr *StatMgr, tx *tx.Transaction) (*IndexMgr, error) {
+	if isNew {
+		sch := record.NewSchema()
+		sch.AddStringField("indexname", MaxName)
+		sch.AddStringField("tablename", MaxName)
+		sch.AddStringField("fieldname", MaxName)
+		if err := tblMgr.CreateTable("idxcat", sch, tx); err != nil {
+			return nil, fmt.Errorf("create idxcat: %w", err)
+		}
+	}
+	layout, err := tblMgr.GetLayout("idxcat", tx)
+	if err != nil {
+		return nil, fmt.Errorf("tblMgr.GetLayout: %w", err)
+	}
+	return &IndexMgr{
+		layout:  layout,
+		tblMgr:  tblMgr,
+		statMgr: statMgr,
+	}, nil
+}
+
+// CreateIndex registers an index on the field of the table in the catalog.
+// It returns ErrTableNotFound or ErrFieldNotFound if the table or the field does not exist,
+// and record.ErrSlotTooLarge if an index record does not fit in a block.
+func (im *IndexMgr) CreateIndex(idxname string, tblname string, fldname string, tx *tx.Transaction) (err error) {
+	if err := checkLength("indexname", idxname, MaxName); err != nil {
+		return err
+	}
+	tblLayout, err := im.tblMgr.GetLayout(tblname, tx)
+	if err != nil {
+		return fmt.Errorf("tblMgr.GetLayout: %w", err)
+	}
+	if !tblLayout.Schema().HasField(fldname) {
+		return fmt.Errorf("%s.%s: %w", tblname, fldname, ErrFieldNotFound)
+	}
+	ii := NewIndexInfo(idxname, fldname, tblLayout.Schema(), tx.BlockSize(), StatInfo{})
+	if size := ii.Layout().SlotSize(); size > tx.BlockSize() {
+		return fmt.Errorf("%w: index slot of %d bytes in blocks of %d bytes", record.ErrSlotTooLarge, size, tx.BlockSize())
+	}
+
+	ts, err := record.NewTableScan(tx, "idxcat", im.layout)
+	if err != nil {
+		return fmt.Errorf("record.NewTableScan: %w", err)
+	}
+	defer func() {
+		if cerr := ts.Close(); cerr != nil {
+			err = errors.Join(err, fmt.Errorf("ts.Close: %w", cerr))
+		}
+	}()
+	if err := ts.Insert(); err != nil {
+		return fmt.Errorf("ts.Insert: %w", err)
+	}
+	if err := ts.SetString("indexname", idxname); err != nil {
+		return fmt.Errorf("ts.SetString: %w", err)
+	}
+	if err := ts.SetString("tablename", tblname); err != nil {
+		return fmt.Errorf("ts.SetString: %w", err)
+	}
+	if err := ts.SetString("fieldname", fldname); err != nil {
+		return fmt.Errorf("ts.SetString: %w", err)
+	}
+	return nil
+}
+
+// GetIndexInfo returns the indexes of the table, keyed by the indexed field name.
+func (im *IndexMgr) GetIndexInfo(tblname string, tx *tx.Transaction) (map[string]*IndexInfo, error) {
+	type entry struct{ idxname, fldname string }
+	var entries []entry
+
+	ts, err := record.NewTableScan(tx, "idxcat", im.layout)
+	if err != nil {
+		return nil, fmt.Errorf("record.NewTableScan: %w", err)
+	}
+	for {
+		ok, err := ts.Next()
+		if err != nil {
+			ts.Close()
+			return nil, fmt.Errorf("ts.Next: %w", err)
+		}
+		if !ok {
+			break
+		}
+		name, err := ts.GetString("tablename")
+		if err != nil {
+			ts.Close()
+			return nil, fmt.Errorf("ts.GetString: %w", err)
+		}
+		if name != tblname {
+			continue
+		}
+		idxname, err := ts.GetString("indexname")
+		if err != nil {
+			ts.Close()
+			return nil, fmt.Errorf("ts.GetString: %w", err)
+		}
+		fldname, err := ts.GetString("fieldname")
+		if err != nil {
+			ts.Close()
+			return nil, fmt.Errorf("ts.GetString: %w", err)
+		}
+		entries = append(entries, entry{idxname, fldname})
+	}
+	if err := ts.Close(); err != nil {
+		return nil, fmt.Errorf("ts.Close: %w", err)
+	}
+
+	result := make(map[string]*IndexInfo)
+	if len(entries) == 0 {
+		return result, nil
+	}
+	tblLayout, err := im.tblMgr.GetLayout(tblname, tx)
+	if err != nil {
+		return nil, fmt.Errorf("tblMgr.GetLayout: %w", err)
+	}
+	si, err := im.statMgr.GetStatInfo(tblname, tblLayout, tx)
+	if err != nil {
+		return nil, fmt.Errorf("statMgr.GetStatInfo: %w", err)
+	}
+	for _, e := range entries {
+		result[e.fldname] = NewIndexInfo(e.idxname, e.fldname, tblLayout.Schema(), tx.BlockSize(), si)
+	}
+	return result, nil
+}
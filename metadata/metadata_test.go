@@ -0,0 +1,219 @@
+package metadata_test
+
+import (
+	"ddai-go/metadata"
+	"ddai-go/record"
+	"ddai-go/server"
+	"errors"
+	"path"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestMetadataMgr(t *testing.T) {
+	t.Parallel()
+
+	dbDir := path.Join(t.TempDir(), "metadatatest")
+	db, err := server.NewSimpleDBWithMetadata(dbDir, 400, 8)
+	if err != nil {
+		t.Fatalf("server.NewSimpleDBWithMetadata: %v", err)
+	}
+	mdm := db.MetadataManager
+	tx := db.NewTx()
+
+	sch := record.NewSchema()
+	sch.AddIntField("A")
+	sch.AddStringField("B", 9)
+	if err := mdm.CreateTable("MyTable", sch, tx); err != nil {
+		t.Fatalf("mdm.CreateTable: %v", err)
+	}
+
+	layout, err := mdm.GetLayout("MyTable", tx)
+	if err != nil {
+		t.Fatalf("mdm.GetLayout: %v", err)
+	}
+	if got := layout.SlotSize(); got != 30 {
+		t.Errorf("layout.SlotSize()=%d, want 30", got)
+	}
+	if got := layout.Schema().Fields(); !slices.Equal(got, []string{"A", "B"}) {
+		t.Errorf("fields=%v, want [A B]", got)
+	}
+	if typ := layout.Schema().Type("B"); typ != record.Varchar {
+		t.Errorf("type of B=%d, want %d", typ, record.Varchar)
+	}
+	if length := layout.Schema().Length("B"); length != 9 {
+		t.Errorf("length of B=%d, want 9", length)
+	}
+
+	if _, err := mdm.GetLayout("NoTable", tx); !errors.Is(err, metadata.ErrTableNotFound) {
+		t.Errorf("mdm.GetLayout(NoTable) err=%v, want ErrTableNotFound", err)
+	}
+
+	// a record must fit in a block
+	large := record.NewSchema()
+	large.AddIntField("A")
+	large.AddStringField("B", 500)
+	if err := mdm.CreateTable("LargeTable", large, tx); !errors.Is(err, record.ErrSlotTooLarge) {
+		t.Errorf("mdm.CreateTable(LargeTable) err=%v, want ErrSlotTooLarge", err)
+	}
+	if _, err := mdm.GetLayout("LargeTable", tx); !errors.Is(err, metadata.ErrTableNotFound) {
+		t.Errorf("mdm.GetLayout(LargeTable) err=%v, want ErrTableNotFound", err)
+	}
+	// the slot size does not overflow
+	huge := record.NewSchema()
+	huge.AddStringField("A", 2000000000)
+	huge.AddStringField("B", 2000000000)
+	if err := mdm.CreateTable("HugeTable", huge, tx); !errors.Is(err, record.ErrSlotTooLarge) {
+		t.Errorf("mdm.CreateTable(HugeTable) err=%v, want ErrSlotTooLarge", err)
+	}
+
+	// a table is registered once
+	if err := mdm.CreateTable("MyTable", sch, tx); !errors.Is(err, metadata.ErrTableExists) {
+		t.Errorf("mdm.CreateTable(MyTable) again err=%v, want ErrTableExists", err)
+	}
+	// names longer than MaxName are rejected before a catalog record is inserted
+	if err := mdm.CreateTable("TableWithLongName", sch, tx); !errors.Is(err, record.ErrValueTooLong) {
+		t.Errorf("mdm.CreateTable(TableWithLongName) err=%v, want ErrValueTooLong", err)
+	}
+	longField := record.NewSchema()
+	longField.AddIntField("FieldWithLongName")
+	if err := mdm.CreateTable("LongField", longField, tx); !errors.Is(err, record.ErrValueTooLong) {
+		t.Errorf("mdm.CreateTable(LongField) err=%v, want ErrValueTooLong", err)
+	}
+	if _, err := mdm.GetLayout("LongField", tx); !errors.Is(err, metadata.ErrTableNotFound) {
+		t.Errorf("mdm.GetLayout(LongField) err=%v, want ErrTableNotFound", err)
+	}
+	layout, err = mdm.GetLayout("MyTable", tx)
+	if err != nil {
+		t.Fatalf("mdm.GetLayout: %v", err)
+	}
+	if got := layout.Schema().Fields(); !slices.Equal(got, []string{"A", "B"}) || layout.SlotSize() != 30 {
+		t.Errorf("fields=%v, slot size=%d, want [A B] and 30", got, layout.SlotSize())
+	}
+
+	// statistics
+	ts, err := record.NewTableScan(tx, "MyTable", layout)
+	if err != nil {
+		t.Fatalf("record.NewTableScan: %v", err)
+	}
+	for i := range int32(50) {
+		if err := ts.Insert(); err != nil {
+			t.Fatalf("ts.Insert: %v", err)
+		}
+		if err := ts.SetInt("A", i); err != nil {
+			t.Fatalf("ts.SetInt: %v", err)
+		}
+		if err := ts.SetString("B", "rec"); err != nil {
+			t.Fatalf("ts.SetString: %v", err)
+		}
+	}
+	if err := ts.Close(); err != nil {
+		t.Fatalf("ts.Close: %v", err)
+	}
+	si, err := mdm.GetStatInfo("MyTable", layout, tx)
+	if err != nil {
+		t.Fatalf("mdm.GetStatInfo: %v", err)
+	}
+	if got := si.RecordsOutput(); got != 50 {
+		t.Errorf("si.RecordsOutput()=%d, want 50", got)
+	}
+	if got := si.BlocksAccessed(); got != 4 { // 13 records per block
+		t.Errorf("si.BlocksAccessed()=%d, want 4", got)
+	}
+
+	// views
+	viewdef := "select B from MyTable where A = 1"
+	if err := mdm.CreateView("viewA", viewdef, tx); err != nil {
+		t.Fatalf("mdm.CreateView: %v", err)
+	}
+	if got, ok, err := mdm.GetViewDef("viewA", tx); err != nil || !ok || got != viewdef {
+		t.Errorf("mdm.GetViewDef(viewA)=(%q, %v, %v), want %q", got, ok, err, viewdef)
+	}
+	if _, ok, err := mdm.GetViewDef("viewB", tx); err != nil || ok {
+		t.Errorf("mdm.GetViewDef(viewB)=(%v, %v), want not found", ok, err)
+	}
+	longdef := "select B from MyTable where A = 1" + strings.Repeat(" and A = 1", 10)
+	if err := mdm.CreateView("viewB", longdef, tx); !errors.Is(err, record.ErrValueTooLong) {
+		t.Errorf("mdm.CreateView(viewB) err=%v, want ErrValueTooLong", err)
+	}
+	if err := mdm.CreateView("viewWithAVeryLongName", viewdef, tx); !errors.Is(err, record.ErrValueTooLong) {
+		t.Errorf("mdm.CreateView(viewWithAVeryLongName) err=%v, want ErrValueTooLong", err)
+	}
+	if _, ok, err := mdm.GetViewDef("viewB", tx); err != nil || ok {
+		t.Errorf("mdm.GetViewDef(viewB) after failure=(%v, %v), want not found", ok, err)
+	}
+
+	// indexes
+	if err := mdm.CreateIndex("indexA", "MyTable", "A", tx); err != nil {
+		t.Fatalf("mdm.CreateIndex: %v", err)
+	}
+	if err := mdm.CreateIndex("indexB", "MyTable", "B", tx); err != nil {
+		t.Fatalf("mdm.CreateIndex: %v", err)
+	}
+	if err := mdm.CreateIndex("indexC", "NoTable", "A", tx); !errors.Is(err, metadata.ErrTableNotFound) {
+		t.Errorf("mdm.CreateIndex(NoTable) err=%v, want ErrTableNotFound", err)
+	}
+	if err := mdm.CreateIndex("indexC", "MyTable", "C", tx); !errors.Is(err, metadata.ErrFieldNotFound) {
+		t.Errorf("mdm.CreateIndex(MyTable.C) err=%v, want ErrFieldNotFound", err)
+	}
+	// the record fits in a block, but the index record does not
+	wide := record.NewSchema()
+	wide.AddStringField("C", 194)
+	if err := mdm.CreateTable("WideTable", wide, tx); err != nil {
+		t.Fatalf("mdm.CreateTable(WideTable): %v", err)
+	}
+	if err := mdm.CreateIndex("indexC", "WideTable", "C", tx); !errors.Is(err, record.ErrSlotTooLarge) {
+		t.Errorf("mdm.CreateIndex(WideTable.C) err=%v, want ErrSlotTooLarge", err)
+	}
+	if got := metadata.NewIndexInfo("indexC", "C", wide, 400, metadata.NewStatInfo(10, 100)).BlocksAccessed(); got != 1 {
+		t.Errorf("BlocksAccessed() of an index on WideTable.C=%d, want 1", got)
+	}
+	indexes, err := mdm.GetIndexInfo("MyTable", tx)
+	if err != nil {
+		t.Fatalf("mdm.GetIndexInfo: %v", err)
+	}
+	if len(indexes) != 2 {
+		t.Fatalf("len(indexes)=%d, want 2", len(indexes))
+	}
+	if got := indexes["A"].IndexName(); got != "indexA" {
+		t.Errorf("index on A=%q, want indexA", got)
+	}
+	if got := indexes["B"].Layout().Schema().Type("dataval"); got != record.Varchar {
+		t.Errorf("dataval type of indexB=%d, want %d", got, record.Varchar)
+	}
+	if got := indexes["A"].DistinctValues("A"); got != 1 {
+		t.Errorf("indexes[A].DistinctValues(A)=%d, want 1", got)
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("tx.Commit: %v", err)
+	}
+
+	// the catalog survives a restart
+	db, err = server.NewSimpleDBWithMetadata(dbDir, 400, 8)
+	if err != nil {
+		t.Fatalf("server.NewSimpleDBWithMetadata: %v", err)
+	}
+	tx = db.NewTx()
+	layout, err = db.MetadataManager.GetLayout("MyTable", tx)
+	if err != nil {
+		t.Fatalf("mdm.GetLayout: %v", err)
+	}
+	if got := layout.Schema().Fields(); !slices.Equal(got, []string{"A", "B"}) {
+		t.Errorf("fields after restart=%v, want [A B]", got)
+	}
+	if got, ok, err := db.MetadataManager.GetViewDef("viewA", tx); err != nil || !ok || got != viewdef {
+		t.Errorf("mdm.GetViewDef(viewA) after restart=(%q, %v, %v), want %q", got, ok, err, viewdef)
+	}
+	si, err = db.MetadataManager.GetStatInfo("MyTable", layout, tx)
+	if err != nil {
+		t.Fatalf("mdm.GetStatInfo: %v", err)
+	}
+	if got := si.RecordsOutput(); got != 50 {
+		t.Errorf("si.RecordsOutput() after restart=%d, want 50", got)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("tx.Commit: %v", err)
+	}
+}
@@ -0,0 +1,69 @@
+package metadata
+
+import (
+	"ddai-go/record"
+	"ddai-go/tx"
+	"fmt"
+)
+
+// MetadataMgr is the single entry point to the table, view, statistics and index metadata.
+type MetadataMgr struct {
+	tblMgr  *TableMgr
+	viewMgr *ViewMgr
+	statMgr *StatMgr
+	idxMgr  *IndexMgr
+}
+
+// NewMetadataMgr creates the catalog tables if the database is new, and loads the statistics.
+func NewMetadataMgr(isNew bool, tx *tx.Transaction) (*MetadataMgr, error) {
+	tblMgr, err := NewTableMgr(isNew, tx)
+	if err != nil {
+		return nil, fmt.Errorf("NewTableMgr: %w", err)
+	}
+	viewMgr, err := NewViewMgr(isNew, tblMgr, tx)
+	if err != nil {
+		return nil, fmt.Errorf("NewViewMgr: %w", err)
+	}
+	statMgr, err := NewStatMgr(tblMgr, tx)
+	if err != nil {
+		return nil, fmt.Errorf("NewStatMgr: %w", err)
+	}
+	idxMgr, err := NewIndexMgr(isNew, tblMgr, statMgr, tx)
+	if err != nil {
+		return nil, fmt.Errorf("NewIndexMgr: %w", err)
+	}
+	return &MetadataMgr{
+		tblMgr:  tblMgr,
+		viewMgr: viewMgr,
+		statMgr: statMgr,
+		idxMgr:  idxMgr,
+	}, nil
+}
+
+func (mm *MetadataMgr) CreateTable(tblname string, sch *record.Schema, tx *tx.Transaction) error {
+	return mm.tblMgr.CreateTable(tblname, sch, tx)
+}
+
+func (mm *MetadataMgr) GetLayout(tblname string, tx *tx.Transaction) (*record.Layout, error) {
+	return mm.tblMgr.GetLayout(tblname, tx)
+}
+
+func (mm *MetadataMgr) CreateView(viewname string, viewdef string, tx *tx.Transaction) error {
+	return mm.viewMgr.CreateView(viewname, viewdef, tx)
+}
+
+func (mm *MetadataMgr) GetViewDef(viewname string, tx *tx.Transaction) (string, bool, error) {
+	return mm.viewMgr.GetViewDef(viewname, tx)
+}
+
+func (mm *MetadataMgr) CreateIndex(idxname string, tblname string, fldname string, tx *tx.Transaction) error {
+	return mm.idxMgr.CreateIndex(idxname, tblname, fldname, tx)
+}
+
+func (mm *MetadataMgr) GetIndexInfo(tblname string, tx *tx.Transaction) (map[string]*IndexInfo, error) {
+	return mm.idxMgr.GetIndexInfo(tblname, tx)
+}
+
+func (mm *MetadataMgr) GetStatInfo(tblname string, layout *record.Layout, tx *tx.Transaction) (StatInfo, error) {
+	return mm.statMgr.GetStatInfo(tblname, layout, tx)
+}
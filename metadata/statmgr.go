@@ -0,0 +1,133 @@
+package metadata
+
+import (
+	"ddai-go/record"
+	"ddai-go/tx"
+	"fmt"
+	"sync"
+)
+
+// StatInfo holds statistical information about a table.
+type StatInfo struct {
+	numBlocks int32
+	numRecs   int32
+}
+
+func NewStatInfo(numBlocks int32, numRecs int32) StatInfo {
+	return StatInfo{numBlocks: numBlocks, numRecs: numRecs}
+}
+
+func (si StatInfo) BlocksAccessed() int32 {
+	return si.numBlocks
+}
+
+func (si StatInfo) RecordsOutput() int32 {
+	return si.numRecs
+}
+
+// DistinctValues estimates the number of distinct values of the field.
+// This is a wild guess, since the distinct values are not tracked.
+func (si StatInfo) DistinctValues(fldname string) int32 {
+	return 1 + si.numRecs/3
+}
+
+// refreshLimit is the number of GetStatInfo calls after which all statistics are recalculated.
+const refreshLimit = 100
+
+// StatMgr keeps statistics of every table in memory.
+// The statistics are calculated by scanning the tables on startup, and periodically after that.
+type StatMgr struct {
+	tblMgr     *TableMgr
+	tableStats map[string]StatInfo
+	numCalls   int
+	mu         sync.Mutex
+}
+
+func NewStatMgr(tblMgr *TableMgr, tx *tx.Transaction) (*StatMgr, error) {
+	sm := &StatMgr{tblMgr: tblMgr}
+	if err := sm.refreshStatistics(tx); err != nil {
+		return nil, fmt.Errorf("sm.refreshStatistics: %w", err)
+	}
+	return sm, nil
+}
+
+func (sm *StatMgr) GetStatInfo(tblname string, layout *record.Layout, tx *tx.Transaction) (StatInfo, error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	sm.numCalls++
+	if sm.numCalls > refreshLimit {
+		if err := sm.refreshStatistics(tx); err != nil {
+			return StatInfo{}, fmt.Errorf("sm.refreshStatistics: %w", err)
+		}
+	}
+	si, ok := sm.tableStats[tblname]
+	if !ok {
+		var err error
+		si, err = calcTableStats(tblname, layout, tx)
+		if err != nil {
+			return StatInfo{}, fmt.Errorf("calcTableStats: %w", err)
+		}
+		sm.tableStats[tblname] = si
+	}
+	return si, nil
+}
+
+func (sm *StatMgr) refreshStatistics(tx *tx.Transaction) error {
+	sm.tableStats = make(map[string]StatInfo)
+	sm.numCalls = 0
+
+	tcatLayout, err := sm.tblMgr.GetLayout("tblcat", tx)
+	if err != nil {
+		return fmt.Errorf("tblMgr.GetLayout: %w", err)
+	}
+	tcat, err := record.NewTableScan(tx, "tblcat", tcatLayout)
+	if err != nil {
+		return fmt.Errorf("record.NewTableScan: %w", err)
+	}
+	defer tcat.Close()
+	for {
+		ok, err := tcat.Next()
+		if err != nil {
+			return fmt.Errorf("tcat.Next: %w", err)
+		}
+		if !ok {
+			return nil
+		}
+		tblname, err := tcat.GetString("tblname")
+		if err != nil {
+			return fmt.Errorf("tcat.GetString: %w", err)
+		}
+		layout, err := sm.tblMgr.GetLayout(tblname, tx)
+		if err != nil {
+			return fmt.Errorf("tblMgr.GetLayout: %w", err)
+		}
+		si, err := calcTableStats(tblname, layout, tx)
+		if err != nil {
+			return fmt.Errorf("calcTableStats: %w", err)
+		}
+		sm.tableStats[tblname] = si
+	}
+}
+
+func calcTableStats(tblname string, layout *record.Layout, tx *tx.Transaction) (StatInfo, error) {
+	numRecs := int32(0)
+	numBlocks := int32(0)
+	ts, err := record.NewTableScan(tx, tblname, layout)
+	if err != nil {
+		return StatInfo{}, fmt.Errorf("record.NewTableScan: %w", err)
+	}
+	defer ts.Close()
+	for {
+		ok, err := ts.Next()
+		if err != nil {
+			return StatInfo{}, fmt.Errorf("ts.Next: %w", err)
+		}
+		if !ok {
+			break
+		}
+		numRecs++
+		numBlocks = ts.GetRID().BlockNum + 1
+	}
+	return NewStatInfo(numBlocks, numRecs), nil
+}
@@ -0,0 +1,222 @@
+package metadata
+
+import (
+	"ddai-go/record"
+	"ddai-go/tx"
+	"errors"
+	"fmt"
+	"unicode/utf16"
+)
+
+// MaxName is the max number of characters of table and field names.
+const MaxName = 16
+
+var (
+	ErrTableNotFound = errors.New("table not found")
+	ErrTableExists   = errors.New("table already exists")
+	ErrFieldNotFound = errors.New("field not found")
+)
+
+// checkLength returns record.ErrValueTooLong if the value does not fit in a catalog field of the length,
+// so that no catalog record is inserted before all its values are known to fit.
+func checkLength(fldname string, val string, length int32) error {
+	if n := len(utf16.Encode([]rune(val))); n > int(length) {
+		return fmt.Errorf("%w: %d characters in %s of length %d", record.ErrValueTooLong, n, fldname, length)
+	}
+	return nil
+}
+
+// TableMgr stores the metadata of tables in two catalog tables:
+// tblcat(tblname, slotsize) holds a record per table,
+// fldcat(tblname, fldname, type, length, offset) holds a record per field.
+type TableMgr struct {
+	tcatLayout *record.Layout
+	fcatLayout *record.Layout
+}
+
+// NewTableMgr creates the catalog tables if the database is new.
+func NewTableMgr(isNew bool, tx *tx.Transaction) (*TableMgr, error) {
+	tcatSchema := record.NewSchema()
+	tcatSchema.AddStringField("tblname", MaxName)
+	tcatSchema.AddIntField("slotsize")
+
+	fcatSchema := record.NewSchema()
+	fcatSchema.AddStringField("tblname", MaxName)
+	fcatSchema.AddStringField("fldname", MaxName)
+	fcatSchema.AddIntField("type")
+	fcatSchema.AddIntField("length")
+	fcatSchema.AddIntField("offset")
+
+	tm := &TableMgr{
+		tcatLayout: record.NewLayout(tcatSchema),
+		fcatLayout: record.NewLayout(fcatSchema),
+	}
+	if isNew {
+		if err := tm.CreateTable("tblcat", tcatSchema, tx); err != nil {
+			return nil, fmt.Errorf("create tblcat: %w", err)
+		}
+		if err := tm.CreateTable("fldcat", fcatSchema, tx); err != nil {
+			return nil, fmt.Errorf("create fldcat: %w", err)
+		}
+	}
+	return tm, nil
+}
+
+// CreateTable registers a new table in the catalog.
+// It returns ErrTableExists if the table is already registered,
+// and record.ErrSlotTooLarge if a record of the table does not fit in a block.
+func (tm *TableMgr) CreateTable(tblname string, sch *record.Schema, tx *tx.Transaction) (err error) {
+	layout := record.NewLayout(sch)
+	if layout.SlotSize() > tx.BlockSize() {
+		return fmt.Errorf("%w: slot of %d bytes in blocks of %d bytes", record.ErrSlotTooLarge, layout.SlotSize(), tx.BlockSize())
+	}
+	if err := checkLength("tblname", tblname, MaxName); err != nil {
+		return err
+	}
+	for _, fldname := range sch.Fields() {
+		if err := checkLength("fldname", fldname, MaxName); err != nil {
+			return err
+		}
+	}
+	size, err := tm.slotSize(tblname, tx)
+	if err != nil {
+		return err
+	}
+	if size >= 0 {
+		return fmt.Errorf("%s: %w", tblname, ErrTableExists)
+	}
+
+	tcat, err := record.NewTableScan(tx, "tblcat", tm.tcatLayout)
+	if err != nil {
+		return fmt.Errorf("record.NewTableScan: %w", err)
+	}
+	defer func() {
+		if cerr := tcat.Close(); cerr != nil {
+			err = errors.Join(err, fmt.Errorf("tcat.Close: %w", cerr))
+		}
+	}()
+	if err := tcat.Insert(); err != nil {
+		return fmt.Errorf("tcat.Insert: %w", err)
+	}
+	if err := tcat.SetString("tblname", tblname); err != nil {
+		return fmt.Errorf("tcat.SetString: %w", err)
+	}
+	if err := tcat.SetInt("slotsize", layout.SlotSize()); err != nil {
+		return fmt.Errorf("tcat.SetInt: %w", err)
+	}
+
+	fcat, err := record.NewTableScan(tx, "fldcat", tm.fcatLayout)
+	if err != nil {
+		return fmt.Errorf("record.NewTableScan: %w", err)
+	}
+	defer func() {
+		if cerr := fcat.Close(); cerr != nil {
+			err = errors.Join(err, fmt.Errorf("fcat.Close: %w", cerr))
+		}
+	}()
+	for _, fldname := range sch.Fields() {
+		if err := fcat.Insert(); err != nil {
+			return fmt.Errorf("fcat.Insert: %w", err)
+		}
+		if err := fcat.SetString("tblname", tblname); err != nil {
+			return fmt.Errorf("fcat.SetString: %w", err)
+		}
+		if err := fcat.SetString("fldname", fldname); err != nil {
+			return fmt.Errorf("fcat.SetString: %w", err)
+		}
+		if err := fcat.SetInt("type", sch.Type(fldname)); err != nil {
+			return fmt.Errorf("fcat.SetInt: %w", err)
+		}
+		if err := fcat.SetInt("length", sch.Length(fldname)); err != nil {
+			return fmt.Errorf("fcat.SetInt: %w", err)
+		}
+		if err := fcat.SetInt("offset", layout.Offset(fldname)); err != nil {
+			return fmt.Errorf("fcat.SetInt: %w", err)
+		}
+	}
+	return nil
+}
+
+// slotSize returns the slot size of the table recorded in tblcat, and -1 if the table is not registered.
+func (tm *TableMgr) slotSize(tblname string, tx *tx.Transaction) (int32, error) {
+	tcat, err := record.NewTableScan(tx, "tblcat", tm.tcatLayout)
+	if err != nil {
+		return 0, fmt.Errorf("record.NewTableScan: %w", err)
+	}
+	defer tcat.Close()
+	for {
+		ok, err := tcat.Next()
+		if err != nil {
+			return 0, fmt.Errorf("tcat.Next: %w", err)
+		}
+		if !ok {
+			return -1, nil
+		}
+		name, err := tcat.GetString("tblname")
+		if err != nil {
+			return 0, fmt.Errorf("tcat.GetString: %w", err)
+		}
+		if name == tblname {
+			size, err := tcat.GetInt("slotsize")
+			if err != nil {
+				return 0, fmt.Errorf("tcat.GetInt: %w", err)
+			}
+			return size, nil
+		}
+	}
+}
+
+// GetLayout restores the layout of the table from the catalog.
+// It returns ErrTableNotFound if the table is not registered.
+func (tm *TableMgr) GetLayout(tblname string, tx *tx.Transaction) (*record.Layout, error) {
+	size, err := tm.slotSize(tblname, tx)
+	if err != nil {
+		return nil, err
+	}
+	if size < 0 {
+		return nil, fmt.Errorf("%s: %w", tblname, ErrTableNotFound)
+	}
+
+	sch := record.NewSchema()
+	offsets := make(map[string]int32)
+	fcat, err := record.NewTableScan(tx, "fldcat", tm.fcatLayout)
+	if err != nil {
+		return nil, fmt.Errorf("record.NewTableScan: %w", err)
+	}
+	defer fcat.Close()
+	for {
+		ok, err := fcat.Next()
+		if err != nil {
+			return nil, fmt.Errorf("fcat.Next: %w", err)
+		}
+		if !ok {
+			break
+		}
+		name, err := fcat.GetString("tblname")
+		if err != nil {
+			return nil, fmt.Errorf("fcat.GetString: %w", err)
+		}
+		if name != tblname {
+			continue
+		}
+		fldname, err := fcat.GetString("fldname")
+		if err != nil {
+			return nil, fmt.Errorf("fcat.GetString: %w", err)
+		}
+		typ, err := fcat.GetInt("type")
+		if err != nil {
+			return nil, fmt.Errorf("fcat.GetInt: %w", err)
+		}
+		length, err := fcat.GetInt("length")
+		if err != nil {
+			return nil, fmt.Errorf("fcat.GetInt: %w", err)
+		}
+		offset, err := fcat.GetInt("offset")
+		if err != nil {
+			return nil, fmt.Errorf("fcat.GetInt: %w", err)
+		}
+		offsets[fldname] = offset
+		sch.AddField(fldname, typ, length)
+	}
+	return record.NewLayoutWith(sch, offsets, size), nil
+}
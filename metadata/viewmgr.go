@@ -0,0 +1,96 @@
+package metadata
+
+import (
+	"ddai-go/record"
+	"ddai-go/tx"
+	"errors"
+	"fmt"
+)
+
+// MaxViewDef is the max number of characters of a view definition.
+const MaxViewDef = 100
+
+// ViewMgr stores view definitions in the catalog table viewcat(viewname, viewdef).
+type ViewMgr struct {
+	tblMgr *TableMgr
+}
+
+// NewViewMgr creates the catalog table if the database is new.
+func NewViewMgr(isNew bool, tblMgr *TableMgr, tx *tx.Transaction) (*ViewMgr, error) {
+	if isNew {
+		sch := record.NewSchema()
+		sch.AddStringField("viewname", MaxName)
+		sch.AddStringField("viewdef", MaxViewDef)
+		if err := tblMgr.CreateTable("viewcat", sch, tx); err != nil {
+			return nil, fmt.Errorf("create viewcat: %w", err)
+		}
+	}
+	return &ViewMgr{tblMgr: tblMgr}, nil
+}
+
+// CreateView registers the view in the catalog.
+// It returns record.ErrValueTooLong if the name is longer than MaxName or the definition is longer than MaxViewDef.
+func (vm *ViewMgr) CreateView(vname string, vdef string, tx *tx.Transaction) (err error) {
+	if err := checkLength("viewname", vname, MaxName); err != nil {
+		return err
+	}
+	if err := checkLength("viewdef", vdef, MaxViewDef); err != nil {
+		return err
+	}
+	layout, err := vm.tblMgr.GetLayout("viewcat", tx)
+	if err != nil {
+		return fmt.Errorf("tblMgr.GetLayout: %w", err)
+	}
+	ts, err := record.NewTableScan(tx, "viewcat", layout)
+	if err != nil {
+		return fmt.Errorf("record.NewTableScan: %w", err)
+	}
+	defer func() {
+		if cerr := ts.Close(); cerr != nil {
+			err = errors.Join(err, fmt.Errorf("ts.Close: %w", cerr))
+		}
+	}()
+	if err := ts.Insert(); err != nil {
+		return fmt.Errorf("ts.Insert: %w", err)
+	}
+	if err := ts.SetString("viewname", vname); err != nil {
+		return fmt.Errorf("ts.SetString: %w", err)
+	}
+	if err := ts.SetString("viewdef", vdef); err != nil {
+		return fmt.Errorf("ts.SetString: %w", err)
+	}
+	return nil
+}
+
+// GetViewDef returns the definition of the view, and false if there is no such view.
+func (vm *ViewMgr) GetViewDef(vname string, tx *tx.Transaction) (string, bool, error) {
+	layout, err := vm.tblMgr.GetLayout("viewcat", tx)
+	if err != nil {
+		return "", false, fmt.Errorf("tblMgr.GetLayout: %w", err)
+	}
+	ts, err := record.NewTableScan(tx, "viewcat", layout)
+	if err != nil {
+		return "", false, fmt.Errorf("record.NewTableScan: %w", err)
+	}
+	defer ts.Close()
+	for {
+		ok, err := ts.Next()
+		if err != nil {
+			return "", false, fmt.Errorf("ts.Next: %w", err)
+		}
+		if !ok {
+			return "", false, nil
+		}
+		name, err := ts.GetString("viewname")
+		if err != nil {
+			return "", false, fmt.Errorf("ts.GetString: %w", err)
+		}
+		if name == vname {
+			vdef, err := ts.GetString("viewdef")
+			if err != nil {
+				return "", false, fmt.Errorf("ts.GetString: %w", err)
+			}
+			return vdef, true, nil
+		}
+	}
+}
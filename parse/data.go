@@ -0,0 +1,136 @@
+package parse
+
+import (
+	"ddai-go/record"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Constant is an integer or string literal.
+type Constant struct {
+	Type   record.FieldType
+	IntVal int32
+	StrVal string
+}
+
+func NewIntConstant(val int32) Constant {
+	return Constant{Type: record.Integer, IntVal: val}
+}
+
+func NewStringConstant(val string) Constant {
+	return Constant{Type: record.Varchar, StrVal: val}
+}
+
+func (c Constant) String() string {
+	if c.Type == record.Integer {
+		return strconv.Itoa(int(c.IntVal))
+	}
+	return "'" + strings.ReplaceAll(c.StrVal, "'", "''") + "'"
+}
+
+// Expression is either a constant or a field name.
+type Expression struct {
+	Val       *Constant // nil if the expression is a field name
+	FieldName string
+}
+
+func (e Expression) IsFieldName() bool {
+	return e.Val == nil
+}
+
+func (e Expression) String() string {
+	if e.IsFieldName() {
+		return e.FieldName
+	}
+	return e.Val.String()
+}
+
+// Term is a comparison of two expressions for equality.
+type Term struct {
+	LHS Expression
+	RHS Expression
+}
+
+func (t Term) String() string {
+	return t.LHS.String() + " = " + t.RHS.String()
+}
+
+// Predicate is a conjunction of terms. An empty predicate is always satisfied.
+type Predicate struct {
+	Terms []Term
+}
+
+func (p Predicate) String() string {
+	terms := make([]string, len(p.Terms))
+	for i, t := range p.Terms {
+		terms[i] = t.String()
+	}
+	return strings.Join(terms, " and ")
+}
+
+// Statement is the parsed data of an update command.
+type Statement interface {
+	isStatement()
+}
+
+// QueryData is the parsed data of a select statement.
+type QueryData struct {
+	Fields []string
+	Tables []string
+	Pred   Predicate
+}
+
+// String reconstructs the query, which is used as the definition of a view.
+func (q *QueryData) String() string {
+	s := fmt.Sprintf("select %s from %s", strings.Join(q.Fields, ", "), strings.Join(q.Tables, ", "))
+	if len(q.Pred.Terms) > 0 {
+		s += " where " + q.Pred.String()
+	}
+	return s
+}
+
+type InsertData struct {
+	TableName string
+	Fields    []string
+	Vals      []Constant
+}
+
+type DeleteData struct {
+	TableName string
+	Pred      Predicate
+}
+
+type ModifyData struct {
+	TableName string
+	FieldName string
+	NewVal    Expression
+	Pred      Predicate
+}
+
+type CreateTableData struct {
+	TableName string
+	NewSchema *record.Schema
+}
+
+type CreateViewData struct {
+	ViewName  string
+	QueryData *QueryData
+}
+
+func (d *CreateViewData) ViewDef() string {
+	return d.QueryData.String()
+}
+
+type CreateIndexData struct {
+	IndexName string
+	TableName string
+	FieldName string
+}
+
+func (*InsertData) isStatement()      {}
+func (*DeleteData) isStatement()      {}
+func (*ModifyData) isStatement()      {}
+func (*CreateTableData) isStatement() {}
+func (*CreateViewData) isStatement()  {}
+func (*CreateIndexData) isStatement() {}
@@ -0,0 +1,228 @@
+package parse
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type tokenType int
+
+const (
+	tokEOF tokenType = iota
+	tokDelim
+	tokInt
+	tokString
+	tokKeyword
+	tokID
+	tokIllegal
+)
+
+type token struct {
+	typ tokenType
+	val string
+	pos int // byte offset of the token in the input
+}
+
+func (t token) String() string {
+	switch t.typ {
+	case tokEOF:
+		return "end of input"
+	case tokString:
+		return fmt.Sprintf("'%s'", t.val)
+	default:
+		return fmt.Sprintf("%q", t.val)
+	}
+}
+
+var keywords = []string{
+	"select", "from", "where", "and",
+	"insert", "into", "values", "delete", "update", "set",
+	"create", "table", "int", "varchar", "view", "as", "index", "on",
+}
+
+// SyntaxError reports the position in the input where the parsing failed.
+type SyntaxError struct {
+	Pos int // byte offset in the input
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("syntax error at offset %d: %s", e.Pos, e.Msg)
+}
+
+// Lexer splits an SQL statement into tokens.
+// Keywords and identifiers are case-insensitive and converted to lower case.
+type Lexer struct {
+	input string
+	pos   int
+	tok   token
+}
+
+func NewLexer(s string) *Lexer {
+	l := &Lexer{input: s}
+	l.nextToken()
+	return l
+}
+
+// MatchDelim returns true if the current token is the specified delimiter character.
+func (l *Lexer) MatchDelim(d rune) bool {
+	return l.tok.typ == tokDelim && l.tok.val == string(d)
+}
+
+func (l *Lexer) MatchIntConstant() bool {
+	return l.tok.typ == tokInt
+}
+
+func (l *Lexer) MatchStringConstant() bool {
+	return l.tok.typ == tokString
+}
+
+func (l *Lexer) MatchKeyword(w string) bool {
+	return l.tok.typ == tokKeyword && l.tok.val == w
+}
+
+func (l *Lexer) MatchID() bool {
+	return l.tok.typ == tokID
+}
+
+func (l *Lexer) MatchEOF() bool {
+	return l.tok.typ == tokEOF
+}
+
+func (l *Lexer) EatDelim(d rune) error {
+	if !l.MatchDelim(d) {
+		return l.errorf("expected %q, found %v", d, l.tok)
+	}
+	l.nextToken()
+	return nil
+}
+
+func (l *Lexer) EatIntConstant() (int32, error) {
+	if !l.MatchIntConstant() {
+		return 0, l.errorf("expected integer, found %v", l.tok)
+	}
+	i, err := strconv.ParseInt(l.tok.val, 10, 32)
+	if err != nil {
+		return 0, l.errorf("integer out of range: %s", l.tok.val)
+	}
+	l.nextToken()
+	return int32(i), nil
+}
+
+func (l *Lexer) EatStringConstant() (string, error) {
+	if !l.MatchStringConstant() {
+		return "", l.errorf("expected string, found %v", l.tok)
+	}
+	s := l.tok.val
+	l.nextToken()
+	return s, nil
+}
+
+func (l *Lexer) EatKeyword(w string) error {
+	if !l.MatchKeyword(w) {
+		return l.errorf("expected %q, found %v", w, l.tok)
+	}
+	l.nextToken()
+	return nil
+}
+
+func (l *Lexer) EatID() (string, error) {
+	if !l.MatchID() {
+		return "", l.errorf("expected identifier, found %v", l.tok)
+	}
+	s := l.tok.val
+	l.nextToken()
+	return s, nil
+}
+
+func (l *Lexer) EatEOF() error {
+	if !l.MatchEOF() {
+		return l.errorf("unexpected %v", l.tok)
+	}
+	return nil
+}
+
+func (l *Lexer) errorf(format string, args ...any) error {
+	if l.tok.typ == tokIllegal {
+		return &SyntaxError{Pos: l.tok.pos, Msg: l.tok.val}
+	}
+	return &SyntaxError{Pos: l.tok.pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (l *Lexer) nextToken() {
+	for l.pos < len(l.input) {
+		r, size := utf8.DecodeRuneInString(l.input[l.pos:])
+		if !unicode.IsSpace(r) {
+			break
+		}
+		l.pos += size
+	}
+	start := l.pos
+	if l.pos >= len(l.input) {
+		l.tok = token{typ: tokEOF, pos: start}
+		return
+	}
+
+	r, size := utf8.DecodeRuneInString(l.input[l.pos:])
+	switch {
+	case r == '\'':
+		l.tok = l.scanString(start)
+	case isDigit(r) || (r == '-' && l.peekDigit(size)):
+		l.pos += size
+		for l.pos < len(l.input) && isDigit(rune(l.input[l.pos])) {
+			l.pos++
+		}
+		l.tok = token{typ: tokInt, val: l.input[start:l.pos], pos: start}
+	case r == '_' || unicode.IsLetter(r):
+		for l.pos < len(l.input) {
+			r, size := utf8.DecodeRuneInString(l.input[l.pos:])
+			if r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+				break
+			}
+			l.pos += size
+		}
+		word := strings.ToLower(l.input[start:l.pos])
+		typ := tokID
+		if slices.Contains(keywords, word) {
+			typ = tokKeyword
+		}
+		l.tok = token{typ: typ, val: word, pos: start}
+	default:
+		l.pos += size
+		l.tok = token{typ: tokDelim, val: string(r), pos: start}
+	}
+}
+
+// scanString reads a string constant enclosed in single quotes.
+// A single quote inside the string is written as two single quotes.
+func (l *Lexer) scanString(start int) token {
+	var sb strings.Builder
+	l.pos++ // skip the opening quote
+	for l.pos < len(l.input) {
+		c := l.input[l.pos]
+		l.pos++
+		if c != '\'' {
+			sb.WriteByte(c)
+			continue
+		}
+		if l.pos < len(l.input) && l.input[l.pos] == '\'' {
+			sb.WriteByte('\'')
+			l.pos++
+			continue
+		}
+		return token{typ: tokString, val: sb.String(), pos: start}
+	}
+	return token{typ: tokIllegal, val: "unterminated string constant", pos: start}
+}
+
+func (l *Lexer) peekDigit(offset int) bool {
+	return l.pos+offset < len(l.input) && isDigit(rune(l.input[l.pos+offset]))
+}
+
+func isDigit(r rune) bool {
+	return '0' <= r && r <= '9'
+}
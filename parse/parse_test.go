@@ -0,0 +1,241 @@
+package parse_test
+
+import (
+	"ddai-go/parse"
+	"ddai-go/record"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func intConst(i int32) *parse.Constant {
+	c := parse.NewIntConstant(i)
+	return &c
+}
+
+func strConst(s string) *parse.Constant {
+	c := parse.NewStringConstant(s)
+	return &c
+}
+
+func TestLexer(t *testing.T) {
+	t.Parallel()
+
+	lex := parse.NewLexer("SELECT a_1, 'it''s' FROM T where -12")
+	steps := []struct {
+		name string
+		eat  func() (any, error)
+		want any
+	}{
+		{"keyword", func() (any, error) { return nil, lex.EatKeyword("select") }, nil},
+		{"id", func() (any, error) { return lex.EatID() }, "a_1"},
+		{"delim", func() (any, error) { return nil, lex.EatDelim(',') }, nil},
+		{"string", func() (any, error) { return lex.EatStringConstant() }, "it's"},
+		{"keyword", func() (any, error) { return nil, lex.EatKeyword("from") }, nil},
+		{"id lowercased", func() (any, error) { return lex.EatID() }, "t"},
+		{"keyword lowercased", func() (any, error) { return nil, lex.EatKeyword("where") }, nil},
+		{"negative int", func() (any, error) { return lex.EatIntConstant() }, int32(-12)},
+		{"eof", func() (any, error) { return nil, lex.EatEOF() }, nil},
+	}
+	for _, s := range steps {
+		got, err := s.eat()
+		if err != nil {
+			t.Fatalf("%s: %v", s.name, err)
+		}
+		if got != s.want {
+			t.Fatalf("%s: got %v, want %v", s.name, got, s.want)
+		}
+	}
+}
+
+func TestParserQuery(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		sql  string
+		want *parse.QueryData
+	}{
+		{
+			name: "single table",
+			sql:  "select a from t",
+			want: &parse.QueryData{Fields: []string{"a"}, Tables: []string{"t"}},
+		},
+		{
+			name: "join with predicate",
+			sql:  "SELECT SName, DName FROM student, dept WHERE MajorId = DId AND GradYear = 2020 and sname = 'joe'",
+			want: &parse.QueryData{
+				Fields: []string{"sname", "dname"},
+				Tables: []string{"student", "dept"},
+				Pred: parse.Predicate{Terms: []parse.Term{
+					{LHS: parse.Expression{FieldName: "majorid"}, RHS: parse.Expression{FieldName: "did"}},
+					{LHS: parse.Expression{FieldName: "gradyear"}, RHS: parse.Expression{Val: intConst(2020)}},
+					{LHS: parse.Expression{FieldName: "sname"}, RHS: parse.Expression{Val: strConst("joe")}},
+				}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := parse.NewParser(tt.sql).Query()
+			if err != nil {
+				t.Fatalf("Query: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParserUpdateCmd(t *testing.T) {
+	t.Parallel()
+
+	studentSchema := record.NewSchema()
+	studentSchema.AddIntField("sid")
+	studentSchema.AddStringField("sname", 10)
+
+	tests := []struct {
+		name string
+		sql  string
+		want parse.Statement
+	}{
+		{
+			name: "insert",
+			sql:  "insert into student (sid, sname) values (1, 'joe')",
+			want: &parse.InsertData{
+				TableName: "student",
+				Fields:    []string{"sid", "sname"},
+				Vals:      []parse.Constant{parse.NewIntConstant(1), parse.NewStringConstant("joe")},
+			},
+		},
+		{
+			name: "delete all",
+			sql:  "delete from student",
+			want: &parse.DeleteData{TableName: "student"},
+		},
+		{
+			name: "delete where",
+			sql:  "delete from student where sid = 1",
+			want: &parse.DeleteData{
+				TableName: "student",
+				Pred: parse.Predicate{Terms: []parse.Term{
+					{LHS: parse.Expression{FieldName: "sid"}, RHS: parse.Expression{Val: intConst(1)}},
+				}},
+			},
+		},
+		{
+			name: "update",
+			sql:  "update student set sname = 'amy' where sid = 2",
+			want: &parse.ModifyData{
+				TableName: "student",
+				FieldName: "sname",
+				NewVal:    parse.Expression{Val: strConst("amy")},
+				Pred: parse.Predicate{Terms: []parse.Term{
+					{LHS: parse.Expression{FieldName: "sid"}, RHS: parse.Expression{Val: intConst(2)}},
+				}},
+			},
+		},
+		{
+			name: "create table",
+			sql:  "create table student (sid int, sname varchar(10))",
+			want: &parse.CreateTableData{TableName: "student", NewSchema: studentSchema},
+		},
+		{
+			name: "create view",
+			sql:  "create view names as select sname from student where sid = 1",
+			want: &parse.CreateViewData{
+				ViewName: "names",
+				QueryData: &parse.QueryData{
+					Fields: []string{"sname"},
+					Tables: []string{"student"},
+					Pred: parse.Predicate{Terms: []parse.Term{
+						{LHS: parse.Expression{FieldName: "sid"}, RHS: parse.Expression{Val: intConst(1)}},
+					}},
+				},
+			},
+		},
+		{
+			name: "create index",
+			sql:  "create index sidx on student (sid)",
+			want: &parse.CreateIndexData{IndexName: "sidx", TableName: "student", FieldName: "sid"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := parse.NewParser(tt.sql).UpdateCmd()
+			if err != nil {
+				t.Fatalf("UpdateCmd: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParserSyntaxError(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		sql     string
+		query   bool
+		wantPos int
+	}{
+		{name: "missing from", sql: "select a b", query: true, wantPos: 9},
+		{name: "trailing and", sql: "select a from t where a = 1 and", query: true, wantPos: 31},
+		{name: "trailing garbage", sql: "select a from t;", query: true, wantPos: 15},
+		{name: "keyword as field", sql: "select from from t", query: true, wantPos: 7},
+		{name: "unterminated string", sql: "select a from t where b = 'abc", query: true, wantPos: 26},
+		{name: "int out of range", sql: "select a from t where b = 9999999999", query: true, wantPos: 26},
+		{name: "unknown command", sql: "drop table t", wantPos: 0},
+		{name: "unknown type", sql: "create table t (a float)", wantPos: 18},
+		{name: "duplicate field", sql: "create table t (a int, a int)", wantPos: 23},
+		{name: "zero varchar length", sql: "create table t (a int, b varchar(0))", wantPos: 33},
+		{name: "negative varchar length", sql: "create table t (b varchar(-5))", wantPos: 26},
+		{name: "values mismatch", sql: "insert into t (a, b) values (1)", wantPos: 28},
+		{name: "missing create target", sql: "create t", wantPos: 7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var err error
+			if tt.query {
+				_, err = parse.NewParser(tt.sql).Query()
+			} else {
+				_, err = parse.NewParser(tt.sql).UpdateCmd()
+			}
+			var se *parse.SyntaxError
+			if !errors.As(err, &se) {
+				t.Fatalf("err=%v, want *parse.SyntaxError", err)
+			}
+			if se.Pos != tt.wantPos {
+				t.Errorf("pos=%d, want %d (%v)", se.Pos, tt.wantPos, se)
+			}
+		})
+	}
+}
+
+func TestQueryDataString(t *testing.T) {
+	t.Parallel()
+
+	sql := "select a, b from t, u where a = 'it''s' and b = -1"
+	qd, err := parse.NewParser(sql).Query()
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if got := qd.String(); got != sql {
+		t.Errorf("qd.String()=%q, want %q", got, sql)
+	}
+	// the string can be parsed again into the same query
+	qd2, err := parse.NewParser(qd.String()).Query()
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if !reflect.DeepEqual(qd, qd2) {
+		t.Errorf("reparsed %+v, want %+v", qd2, qd)
+	}
+}
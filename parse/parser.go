@@ -0,0 +1,432 @@
+package parse
+
+import (
+	"ddai-go/record"
+)
+
+// Parser is a recursive-descent parser for the SQL subset of SimpleDB:
+//
+//	<Field>       := IdTok
+//	<Constant>    := StrTok | IntTok
+//	<Expression>  := <Field> | <Constant>
+//	<Term>        := <Expression> = <Expression>
+//	<Predicate>   := <Term> [ AND <Predicate> ]
+//	<Query>       := SELECT <SelectList> FROM <TableList> [ WHERE <Predicate> ]
+//	<SelectList>  := <Field> [ , <SelectList> ]
+//	<TableList>   := IdTok [ , <TableList> ]
+//	<UpdateCmd>   := <Insert> | <Delete> | <Modify> | <Create>
+//	<Create>      := <CreateTable> | <CreateView> | <CreateIndex>
+//	<Insert>      := INSERT INTO IdTok ( <FieldList> ) VALUES ( <ConstList> )
+//	<FieldList>   := <Field> [ , <FieldList> ]
+//	<ConstList>   := <Constant> [ , <ConstList> ]
+//	<Delete>      := DELETE FROM IdTok [ WHERE <Predicate> ]
+//	<Modify>      := UPDATE IdTok SET <Field> = <Expression> [ WHERE <Predicate> ]
+//	<CreateTable> := CREATE TABLE IdTok ( <FieldDefs> )
+//	<FieldDefs>   := <FieldDef> [ , <FieldDefs> ]
+//	<FieldDef>    := IdTok <TypeDef>
+//	<TypeDef>     := INT | VARCHAR ( IntTok )
+//	<CreateView>  := CREATE VIEW IdTok AS <Query>
+//	<CreateIndex> := CREATE INDEX IdTok ON IdTok ( <Field> )
+type Parser struct {
+	lex *Lexer
+}
+
+func NewParser(s string) *Parser {
+	return &Parser{lex: NewLexer(s)}
+}
+
+// Query parses a whole select statement.
+func (p *Parser) Query() (*QueryData, error) {
+	qd, err := p.query()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.lex.EatEOF(); err != nil {
+		return nil, err
+	}
+	return qd, nil
+}
+
+// UpdateCmd parses a whole insert, delete, update or create statement.
+func (p *Parser) UpdateCmd() (Statement, error) {
+	var stmt Statement
+	var err error
+	switch {
+	case p.lex.MatchKeyword("insert"):
+		stmt, err = p.insert()
+	case p.lex.MatchKeyword("delete"):
+		stmt, err = p.delete()
+	case p.lex.MatchKeyword("update"):
+		stmt, err = p.modify()
+	default:
+		stmt, err = p.create()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := p.lex.EatEOF(); err != nil {
+		return nil, err
+	}
+	return stmt, nil
+}
+
+func (p *Parser) field() (string, error) {
+	return p.lex.EatID()
+}
+
+func (p *Parser) constant() (Constant, error) {
+	if p.lex.MatchStringConstant() {
+		s, err := p.lex.EatStringConstant()
+		if err != nil {
+			return Constant{}, err
+		}
+		return NewStringConstant(s), nil
+	}
+	if !p.lex.MatchIntConstant() {
+		return Constant{}, p.lex.errorf("expected constant, found %v", p.lex.tok)
+	}
+	i, err := p.lex.EatIntConstant()
+	if err != nil {
+		return Constant{}, err
+	}
+	return NewIntConstant(i), nil
+}
+
+func (p *Parser) expression() (Expression, error) {
+	if p.lex.MatchID() {
+		fldname, err := p.field()
+		if err != nil {
+			return Expression{}, err
+		}
+		return Expression{FieldName: fldname}, nil
+	}
+	if p.lex.MatchStringConstant() || p.lex.MatchIntConstant() {
+		c, err := p.constant()
+		if err != nil {
+			return Expression{}, err
+		}
+		return Expression{Val: &c}, nil
+	}
+	return Expression{}, p.lex.errorf("expected field or constant, found %v", p.lex.tok)
+}
+
+func (p *Parser) term() (Term, error) {
+	lhs, err := p.expression()
+	if err != nil {
+		return Term{}, err
+	}
+	if err := p.lex.EatDelim('='); err != nil {
+		return Term{}, err
+	}
+	rhs, err := p.expression()
+	if err != nil {
+		return Term{}, err
+	}
+	return Term{LHS: lhs, RHS: rhs}, nil
+}
+
+func (p *Parser) predicate() (Predicate, error) {
+	var pred Predicate
+	for {
+		t, err := p.term()
+		if err != nil {
+			return Predicate{}, err
+		}
+		pred.Terms = append(pred.Terms, t)
+		if !p.lex.MatchKeyword("and") {
+			return pred, nil
+		}
+		if err := p.lex.EatKeyword("and"); err != nil {
+			return Predicate{}, err
+		}
+	}
+}
+
+// optionalWhere parses "[ WHERE <Predicate> ]".
+func (p *Parser) optionalWhere() (Predicate, error) {
+	if !p.lex.MatchKeyword("where") {
+		return Predicate{}, nil
+	}
+	if err := p.lex.EatKeyword("where"); err != nil {
+		return Predicate{}, err
+	}
+	return p.predicate()
+}
+
+func (p *Parser) query() (*QueryData, error) {
+	if err := p.lex.EatKeyword("select"); err != nil {
+		return nil, err
+	}
+	fields, err := p.idList()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.lex.EatKeyword("from"); err != nil {
+		return nil, err
+	}
+	tables, err := p.idList()
+	if err != nil {
+		return nil, err
+	}
+	pred, err := p.optionalWhere()
+	if err != nil {
+		return nil, err
+	}
+	return &QueryData{Fields: fields, Tables: tables, Pred: pred}, nil
+}
+
+// idList parses a comma-separated list of identifiers.
+func (p *Parser) idList() ([]string, error) {
+	var ids []string
+	for {
+		id, err := p.lex.EatID()
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+		if !p.lex.MatchDelim(',') {
+			return ids, nil
+		}
+		if err := p.lex.EatDelim(','); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *Parser) constList() ([]Constant, error) {
+	var vals []Constant
+	for {
+		c, err := p.constant()
+		if err != nil {
+			return nil, err
+		}
+		vals = append(vals, c)
+		if !p.lex.MatchDelim(',') {
+			return vals, nil
+		}
+		if err := p.lex.EatDelim(','); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *Parser) insert() (*InsertData, error) {
+	if err := p.lex.EatKeyword("insert"); err != nil {
+		return nil, err
+	}
+	if err := p.lex.EatKeyword("into"); err != nil {
+		return nil, err
+	}
+	tblname, err := p.lex.EatID()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.lex.EatDelim('('); err != nil {
+		return nil, err
+	}
+	fields, err := p.idList()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.lex.EatDelim(')'); err != nil {
+		return nil, err
+	}
+	if err := p.lex.EatKeyword("values"); err != nil {
+		return nil, err
+	}
+	valsPos := p.lex.tok.pos
+	if err := p.lex.EatDelim('('); err != nil {
+		return nil, err
+	}
+	vals, err := p.constList()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.lex.EatDelim(')'); err != nil {
+		return nil, err
+	}
+	if len(fields) != len(vals) {
+		return nil, &SyntaxError{Pos: valsPos, Msg: "number of values does not match number of fields"}
+	}
+	return &InsertData{TableName: tblname, Fields: fields, Vals: vals}, nil
+}
+
+func (p *Parser) delete() (*DeleteData, error) {
+	if err := p.lex.EatKeyword("delete"); err != nil {
+		return nil, err
+	}
+	if err := p.lex.EatKeyword("from"); err != nil {
+		return nil, err
+	}
+	tblname, err := p.lex.EatID()
+	if err != nil {
+		return nil, err
+	}
+	pred, err := p.optionalWhere()
+	if err != nil {
+		return nil, err
+	}
+	return &DeleteData{TableName: tblname, Pred: pred}, nil
+}
+
+func (p *Parser) modify() (*ModifyData, error) {
+	if err := p.lex.EatKeyword("update"); err != nil {
+		return nil, err
+	}
+	tblname, err := p.lex.EatID()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.lex.EatKeyword("set"); err != nil {
+		return nil, err
+	}
+	fldname, err := p.field()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.lex.EatDelim('='); err != nil {
+		return nil, err
+	}
+	newVal, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	pred, err := p.optionalWhere()
+	if err != nil {
+		return nil, err
+	}
+	return &ModifyData{TableName: tblname, FieldName: fldname, NewVal: newVal, Pred: pred}, nil
+}
+
+func (p *Parser) create() (Statement, error) {
+	if err := p.lex.EatKeyword("create"); err != nil {
+		return nil, p.lex.errorf("expected update command, found %v", p.lex.tok)
+	}
+	switch {
+	case p.lex.MatchKeyword("table"):
+		return p.createTable()
+	case p.lex.MatchKeyword("view"):
+		return p.createView()
+	case p.lex.MatchKeyword("index"):
+		return p.createIndex()
+	default:
+		return nil, p.lex.errorf("expected table, view or index, found %v", p.lex.tok)
+	}
+}
+
+func (p *Parser) createTable() (*CreateTableData, error) {
+	if err := p.lex.EatKeyword("table"); err != nil {
+		return nil, err
+	}
+	tblname, err := p.lex.EatID()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.lex.EatDelim('('); err != nil {
+		return nil, err
+	}
+	sch := record.NewSchema()
+	for {
+		if err := p.fieldDef(sch); err != nil {
+			return nil, err
+		}
+		if !p.lex.MatchDelim(',') {
+			break
+		}
+		if err := p.lex.EatDelim(','); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.lex.EatDelim(')'); err != nil {
+		return nil, err
+	}
+	return &CreateTableData{TableName: tblname, NewSchema: sch}, nil
+}
+
+// fieldDef parses a field definition and adds the field to the schema.
+func (p *Parser) fieldDef(sch *record.Schema) error {
+	pos := p.lex.tok.pos
+	fldname, err := p.field()
+	if err != nil {
+		return err
+	}
+	if sch.HasField(fldname) {
+		return &SyntaxError{Pos: pos, Msg: "duplicate field " + fldname}
+	}
+	switch {
+	case p.lex.MatchKeyword("int"):
+		if err := p.lex.EatKeyword("int"); err != nil {
+			return err
+		}
+		sch.AddIntField(fldname)
+	case p.lex.MatchKeyword("varchar"):
+		if err := p.lex.EatKeyword("varchar"); err != nil {
+			return err
+		}
+		if err := p.lex.EatDelim('('); err != nil {
+			return err
+		}
+		lengthPos := p.lex.tok.pos
+		length, err := p.lex.EatIntConstant()
+		if err != nil {
+			return err
+		}
+		// a length too large for a block is rejected when the table is created
+		if length <= 0 {
+			return &SyntaxError{Pos: lengthPos, Msg: "varchar length must be positive"}
+		}
+		if err := p.lex.EatDelim(')'); err != nil {
+			return err
+		}
+		sch.AddStringField(fldname, length)
+	default:
+		return p.lex.errorf("expected int or varchar, found %v", p.lex.tok)
+	}
+	return nil
+}
+
+func (p *Parser) createView() (*CreateViewData, error) {
+	if err := p.lex.EatKeyword("view"); err != nil {
+		return nil, err
+	}
+	viewname, err := p.lex.EatID()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.lex.EatKeyword("as"); err != nil {
+		return nil, err
+	}
+	qd, err := p.query()
+	if err != nil {
+		return nil, err
+	}
+	return &CreateViewData{ViewName: viewname, QueryData: qd}, nil
+}
+
+func (p *Parser) createIndex() (*CreateIndexData, error) {
+	if err := p.lex.EatKeyword("index"); err != nil {
+		return nil, err
+	}
+	idxname, err := p.lex.EatID()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.lex.EatKeyword("on"); err != nil {
+		return nil, err
+	}
+	tblname, err := p.lex.EatID()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.lex.EatDelim('('); err != nil {
+		return nil, err
+	}
+	fldname, err := p.field()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.lex.EatDelim(')'); err != nil {
+		return nil, err
+	}
+	return &CreateIndexData{IndexName: idxname, TableName: tblname, FieldName: fldname}, nil
+}
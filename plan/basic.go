@@ -0,0 +1,195 @@
+package plan
+
+import (
+	"ddai-go/metadata"
+	"ddai-go/parse"
+	"ddai-go/query"
+	"ddai-go/tx"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+var _ QueryPlanner = (*BasicQueryPlanner)(nil)
+
+// BasicQueryPlanner creates the naive plan: the product of all tables in the order of the from clause,
+// followed by a selection of the predicate and a projection of the fields.
+type BasicQueryPlanner struct {
+	mdm *metadata.MetadataMgr
+}
+
+func NewBasicQueryPlanner(mdm *metadata.MetadataMgr) *BasicQueryPlanner {
+	return &BasicQueryPlanner{mdm: mdm}
+}
+
+func (qp *BasicQueryPlanner) CreatePlan(data *parse.QueryData, tx *tx.Transaction) (Plan, error) {
+	return qp.createPlan(data, tx, nil)
+}
+
+func (qp *BasicQueryPlanner) createPlan(data *parse.QueryData, tx *tx.Transaction, views []string) (Plan, error) {
+	plans := make([]Plan, 0, len(data.Tables))
+	for _, tblname := range data.Tables {
+		p, err := tableOrViewPlan(tblname, qp, qp.mdm, tx, views)
+		if err != nil {
+			return nil, err
+		}
+		plans = append(plans, p)
+	}
+
+	p := plans[0]
+	for _, next := range plans[1:] {
+		p = NewProductPlan(p, next)
+	}
+	p = NewSelectPlan(p, predicateFrom(data.Pred))
+	return NewProjectPlan(p, data.Fields), nil
+}
+
+// ErrViewCycle is returned when the definition of a view refers to the view itself, directly or through other views.
+var ErrViewCycle = errors.New("view refers to itself")
+
+// viewPlanner is a QueryPlanner that can plan the definition of a view,
+// while the views are expanded, in order to detect a view referring to itself.
+type viewPlanner interface {
+	createPlan(data *parse.QueryData, tx *tx.Transaction, views []string) (Plan, error)
+}
+
+// tableOrViewPlan creates the plan of a table, or of the definition of a view.
+// views are the views being expanded, which the definition must not refer to.
+func tableOrViewPlan(tblname string, qp viewPlanner, mdm *metadata.MetadataMgr, tx *tx.Transaction, views []string) (Plan, error) {
+	viewdef, ok, err := mdm.GetViewDef(tblname, tx)
+	if err != nil {
+		return nil, fmt.Errorf("mdm.GetViewDef: %w", err)
+	}
+	if !ok {
+		return NewTablePlan(tx, tblname, mdm)
+	}
+	if slices.Contains(views, tblname) {
+		return nil, fmt.Errorf("%w: %s", ErrViewCycle, strings.Join(append(views, tblname), " -> "))
+	}
+	viewData, err := parse.NewParser(viewdef).Query()
+	if err != nil {
+		return nil, fmt.Errorf("parse view %s: %w", tblname, err)
+	}
+	return qp.createPlan(viewData, tx, append(slices.Clip(views), tblname))
+}
+
+var _ UpdatePlanner = (*BasicUpdatePlanner)(nil)
+
+// BasicUpdatePlanner executes update commands by scanning the whole table.
+type BasicUpdatePlanner struct {
+	mdm *metadata.MetadataMgr
+}
+
+func NewBasicUpdatePlanner(mdm *metadata.MetadataMgr) *BasicUpdatePlanner {
+	return &BasicUpdatePlanner{mdm: mdm}
+}
+
+func (up *BasicUpdatePlanner) ExecuteInsert(data *parse.InsertData, tx *tx.Transaction) (int, error) {
+	us, err := up.openUpdateScan(data.TableName, nil, tx)
+	if err != nil {
+		return 0, err
+	}
+	defer us.Close()
+	if err := us.Insert(); err != nil {
+		return 0, fmt.Errorf("us.Insert: %w", err)
+	}
+	for i, fldname := range data.Fields {
+		if err := us.SetVal(fldname, constantFrom(data.Vals[i])); err != nil {
+			return 0, fmt.Errorf("us.SetVal: %w", err)
+		}
+	}
+	return 1, nil
+}
+
+func (up *BasicUpdatePlanner) ExecuteDelete(data *parse.DeleteData, tx *tx.Transaction) (int, error) {
+	us, err := up.openUpdateScan(data.TableName, predicateFrom(data.Pred), tx)
+	if err != nil {
+		return 0, err
+	}
+	defer us.Close()
+	count := 0
+	for {
+		ok, err := us.Next()
+		if err != nil {
+			return 0, fmt.Errorf("us.Next: %w", err)
+		}
+		if !ok {
+			return count, nil
+		}
+		if err := us.Delete(); err != nil {
+			return 0, fmt.Errorf("us.Delete: %w", err)
+		}
+		count++
+	}
+}
+
+func (up *BasicUpdatePlanner) ExecuteModify(data *parse.ModifyData, tx *tx.Transaction) (int, error) {
+	us, err := up.openUpdateScan(data.TableName, predicateFrom(data.Pred), tx)
+	if err != nil {
+		return 0, err
+	}
+	defer us.Close()
+	newVal := expressionFrom(data.NewVal)
+	count := 0
+	for {
+		ok, err := us.Next()
+		if err != nil {
+			return 0, fmt.Errorf("us.Next: %w", err)
+		}
+		if !ok {
+			return count, nil
+		}
+		val, err := newVal.Evaluate(us)
+		if err != nil {
+			return 0, fmt.Errorf("newVal.Evaluate: %w", err)
+		}
+		if err := us.SetVal(data.FieldName, val); err != nil {
+			return 0, fmt.Errorf("us.SetVal: %w", err)
+		}
+		count++
+	}
+}
+
+func (up *BasicUpdatePlanner) ExecuteCreateTable(data *parse.CreateTableData, tx *tx.Transaction) (int, error) {
+	if err := up.mdm.CreateTable(data.TableName, data.NewSchema, tx); err != nil {
+		return 0, fmt.Errorf("mdm.CreateTable: %w", err)
+	}
+	return 0, nil
+}
+
+func (up *BasicUpdatePlanner) ExecuteCreateView(data *parse.CreateViewData, tx *tx.Transaction) (int, error) {
+	if err := up.mdm.CreateView(data.ViewName, data.ViewDef(), tx); err != nil {
+		return 0, fmt.Errorf("mdm.CreateView: %w", err)
+	}
+	return 0, nil
+}
+
+func (up *BasicUpdatePlanner) ExecuteCreateIndex(data *parse.CreateIndexData, tx *tx.Transaction) (int, error) {
+	if err := up.mdm.CreateIndex(data.IndexName, data.TableName, data.FieldName, tx); err != nil {
+		return 0, fmt.Errorf("mdm.CreateIndex: %w", err)
+	}
+	return 0, nil
+}
+
+// openUpdateScan opens a scan over the table, selecting the records satisfying pred if it is not nil.
+func (up *BasicUpdatePlanner) openUpdateScan(tblname string, pred *query.Predicate, tx *tx.Transaction) (query.UpdateScan, error) {
+	tp, err := NewTablePlan(tx, tblname, up.mdm)
+	if err != nil {
+		return nil, err
+	}
+	var p Plan = tp
+	if pred != nil {
+		p = NewSelectPlan(tp, pred)
+	}
+	s, err := p.Open()
+	if err != nil {
+		return nil, err
+	}
+	us, ok := s.(query.UpdateScan)
+	if !ok {
+		s.Close()
+		return nil, query.ErrNotUpdatable
+	}
+	return us, nil
+}
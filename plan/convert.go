@@ -0,0 +1,31 @@
+package plan
+
+import (
+	"ddai-go/parse"
+	"ddai-go/query"
+	"ddai-go/record"
+)
+
+// The parser produces syntax trees only, so the planners convert them to the query values evaluated by scans.
+
+func constantFrom(c parse.Constant) query.Constant {
+	if c.Type == record.Integer {
+		return query.NewIntConstant(c.IntVal)
+	}
+	return query.NewStringConstant(c.StrVal)
+}
+
+func expressionFrom(e parse.Expression) query.Expression {
+	if e.IsFieldName() {
+		return query.NewFieldExpression(e.FieldName)
+	}
+	return query.NewConstantExpression(constantFrom(*e.Val))
+}
+
+func predicateFrom(p parse.Predicate) *query.Predicate {
+	terms := make([]query.Term, len(p.Terms))
+	for i, t := range p.Terms {
+		terms[i] = query.NewTerm(expressionFrom(t.LHS), expressionFrom(t.RHS))
+	}
+	return query.NewPredicate(terms...)
+}
@@ -0,0 +1,151 @@
+package plan
+
+import (
+	"ddai-go/metadata"
+	"ddai-go/parse"
+	"ddai-go/query"
+	"ddai-go/record"
+	"ddai-go/tx"
+	"fmt"
+	"slices"
+)
+
+var _ QueryPlanner = (*HeuristicQueryPlanner)(nil)
+
+// HeuristicQueryPlanner creates a plan by the following heuristics:
+//   - selections are pushed down to each table as far as possible,
+//   - the join order is chosen greedily, starting from the table with the smallest output,
+//     and then joining the table that produces the smallest output with the current plan,
+//   - a product is used only when no remaining table can be joined.
+type HeuristicQueryPlanner struct {
+	mdm *metadata.MetadataMgr
+}
+
+func NewHeuristicQueryPlanner(mdm *metadata.MetadataMgr) *HeuristicQueryPlanner {
+	return &HeuristicQueryPlanner{mdm: mdm}
+}
+
+func (qp *HeuristicQueryPlanner) CreatePlan(data *parse.QueryData, tx *tx.Transaction) (Plan, error) {
+	return qp.createPlan(data, tx, nil)
+}
+
+func (qp *HeuristicQueryPlanner) createPlan(data *parse.QueryData, tx *tx.Transaction, views []string) (Plan, error) {
+	pred := predicateFrom(data.Pred)
+	planners := make([]*tablePlanner, 0, len(data.Tables))
+	for _, tblname := range data.Tables {
+		p, err := tableOrViewPlan(tblname, qp, qp.mdm, tx, views)
+		if err != nil {
+			return nil, err
+		}
+		planners = append(planners, newTablePlanner(p, pred))
+	}
+
+	current, planners := getLowestSelectPlan(planners)
+	for len(planners) > 0 {
+		var p Plan
+		p, planners = getLowestJoinPlan(current, planners)
+		if p == nil {
+			p, planners = getLowestProductPlan(current, planners)
+		}
+		current = p
+	}
+	// a term whose fields are not in any table is not pushed down to any plan
+	if err := pred.CheckFields(current.Schema()); err != nil {
+		return nil, fmt.Errorf("pred.CheckFields: %w", err)
+	}
+	return NewProjectPlan(current, data.Fields), nil
+}
+
+// getLowestSelectPlan chooses the table whose selection outputs the fewest records.
+func getLowestSelectPlan(planners []*tablePlanner) (Plan, []*tablePlanner) {
+	var best Plan
+	bestIdx := -1
+	for i, tp := range planners {
+		p := tp.makeSelectPlan()
+		if best == nil || p.RecordsOutput() < best.RecordsOutput() {
+			best, bestIdx = p, i
+		}
+	}
+	return best, slices.Delete(planners, bestIdx, bestIdx+1)
+}
+
+// getLowestJoinPlan chooses the table whose join with the current plan outputs the fewest records.
+// It returns nil if no table can be joined with the current plan.
+func getLowestJoinPlan(current Plan, planners []*tablePlanner) (Plan, []*tablePlanner) {
+	var best Plan
+	bestIdx := -1
+	for i, tp := range planners {
+		p := tp.makeJoinPlan(current)
+		if p != nil && (best == nil || p.RecordsOutput() < best.RecordsOutput()) {
+			best, bestIdx = p, i
+		}
+	}
+	if best == nil {
+		return nil, planners
+	}
+	return best, slices.Delete(planners, bestIdx, bestIdx+1)
+}
+
+// getLowestProductPlan chooses the table whose product with the current plan outputs the fewest records.
+func getLowestProductPlan(current Plan, planners []*tablePlanner) (Plan, []*tablePlanner) {
+	var best Plan
+	bestIdx := -1
+	for i, tp := range planners {
+		p := tp.makeProductPlan(current)
+		if best == nil || p.RecordsOutput() < best.RecordsOutput() {
+			best, bestIdx = p, i
+		}
+	}
+	return best, slices.Delete(planners, bestIdx, bestIdx+1)
+}
+
+// tablePlanner creates the plans involving a single table (or view) of the query.
+type tablePlanner struct {
+	plan   Plan
+	pred   *query.Predicate
+	schema *record.Schema
+}
+
+func newTablePlanner(p Plan, pred *query.Predicate) *tablePlanner {
+	return &tablePlanner{plan: p, pred: pred, schema: p.Schema()}
+}
+
+// makeSelectPlan returns the plan of the table with the terms of the predicate that apply to it.
+func (tp *tablePlanner) makeSelectPlan() Plan {
+	return tp.addSelectPred(tp.plan)
+}
+
+// makeJoinPlan returns the plan joining the table with current, or nil if no term of the predicate joins them.
+func (tp *tablePlanner) makeJoinPlan(current Plan) Plan {
+	joinPred := tp.pred.JoinSubPred(tp.schema, current.Schema())
+	if joinPred == nil {
+		return nil
+	}
+	return tp.makeProductJoin(current)
+}
+
+// makeProductPlan returns the product of current and the table, with the selection pushed down to the table.
+func (tp *tablePlanner) makeProductPlan(current Plan) Plan {
+	return NewProductPlan(current, tp.makeSelectPlan())
+}
+
+func (tp *tablePlanner) makeProductJoin(current Plan) Plan {
+	p := tp.makeProductPlan(current)
+	return tp.addJoinPred(p, current.Schema())
+}
+
+func (tp *tablePlanner) addSelectPred(p Plan) Plan {
+	selectPred := tp.pred.SelectSubPred(tp.schema)
+	if selectPred == nil {
+		return p
+	}
+	return NewSelectPlan(p, selectPred)
+}
+
+func (tp *tablePlanner) addJoinPred(p Plan, currentSchema *record.Schema) Plan {
+	joinPred := tp.pred.JoinSubPred(currentSchema, tp.schema)
+	if joinPred == nil {
+		return p
+	}
+	return NewSelectPlan(p, joinPred)
+}
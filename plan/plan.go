@@ -0,0 +1,18 @@
+package plan
+
+import (
+	"ddai-go/query"
+	"ddai-go/record"
+)
+
+// Plan is a node of a query tree, which estimates the cost of its query and opens a scan for it.
+type Plan interface {
+	Open() (query.Scan, error)
+	// BlocksAccessed estimates the number of block accesses needed to iterate the output of the plan.
+	BlocksAccessed() int32
+	// RecordsOutput estimates the number of records output by the plan.
+	RecordsOutput() int32
+	// DistinctValues estimates the number of distinct values of the field in the output of the plan.
+	DistinctValues(fldname string) int32
+	Schema() *record.Schema
+}
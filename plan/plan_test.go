@@ -0,0 +1,331 @@
+package plan_test
+
+import (
+	"ddai-go/plan"
+	"ddai-go/query"
+	"ddai-go/record"
+	"ddai-go/server"
+	"ddai-go/tx"
+	"errors"
+	"fmt"
+	"math"
+	"path"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func execute(t *testing.T, planner *plan.Planner, tx *tx.Transaction, cmd string) int {
+	t.Helper()
+
+	n, err := planner.ExecuteUpdate(cmd, tx)
+	if err != nil {
+		t.Fatalf("ExecuteUpdate(%q): %v", cmd, err)
+	}
+	return n
+}
+
+// rows returns the values of the fields of every output record, formatted as "v1|v2|...".
+func rows(t *testing.T, p plan.Plan, fields ...string) []string {
+	t.Helper()
+
+	s, err := p.Open()
+	if err != nil {
+		t.Fatalf("p.Open: %v", err)
+	}
+	defer s.Close()
+	var res []string
+	for {
+		ok, err := s.Next()
+		if err != nil {
+			t.Fatalf("s.Next: %v", err)
+		}
+		if !ok {
+			return res
+		}
+		vals := make([]string, len(fields))
+		for i, fldname := range fields {
+			v, err := s.GetVal(fldname)
+			if err != nil {
+				t.Fatalf("s.GetVal(%s): %v", fldname, err)
+			}
+			vals[i] = v.String()
+		}
+		res = append(res, strings.Join(vals, "|"))
+	}
+}
+
+// setupUniversity creates and fills the tables of a university database,
+// and reopens the database so that the statistics of the tables are up to date.
+func setupUniversity(t *testing.T, dbDir string) *server.SimpleDB {
+	t.Helper()
+
+	db, err := server.NewSimpleDBWithMetadata(dbDir, 400, 8)
+	if err != nil {
+		t.Fatalf("server.NewSimpleDBWithMetadata: %v", err)
+	}
+	tx := db.NewTx()
+
+	execute(t, db.Planner, tx, "create table dept (did int, dname varchar(8))")
+	execute(t, db.Planner, tx, "create table student (sid int, sname varchar(10), majorid int, gradyear int)")
+	execute(t, db.Planner, tx, "create table enroll (eid int, studentid int, grade varchar(2))")
+	for i, dname := range []string{"compsci", "math", "drama"} {
+		execute(t, db.Planner, tx, fmt.Sprintf("insert into dept (did, dname) values (%d, '%s')", (i+1)*10, dname))
+	}
+	for i := range 30 {
+		cmd := fmt.Sprintf("insert into student (sid, sname, majorid, gradyear) values (%d, 'student%d', %d, %d)",
+			i, i, (i%3+1)*10, 2020+i%4)
+		execute(t, db.Planner, tx, cmd)
+	}
+	for i := range 60 {
+		cmd := fmt.Sprintf("insert into enroll (eid, studentid, grade) values (%d, %d, '%c')", i, i%30, 'A'+rune(i%5))
+		execute(t, db.Planner, tx, cmd)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("tx.Commit: %v", err)
+	}
+
+	db, err = server.NewSimpleDBWithMetadata(dbDir, 400, 8)
+	if err != nil {
+		t.Fatalf("server.NewSimpleDBWithMetadata: %v", err)
+	}
+	return db
+}
+
+func TestPlanner(t *testing.T) {
+	t.Parallel()
+
+	db, err := server.NewSimpleDBWithMetadata(path.Join(t.TempDir(), "plannertest"), 400, 8)
+	if err != nil {
+		t.Fatalf("server.NewSimpleDBWithMetadata: %v", err)
+	}
+	tx := db.NewTx()
+
+	execute(t, db.Planner, tx, "create table T1 (A int, B varchar(9))")
+	for i := range 200 {
+		if n := execute(t, db.Planner, tx, fmt.Sprintf("insert into T1 (A, B) values (%d, 'rec%d')", i, i)); n != 1 {
+			t.Fatalf("insert affected %d records, want 1", n)
+		}
+	}
+
+	p, err := db.Planner.CreateQueryPlan("select B from T1 where A = 10", tx)
+	if err != nil {
+		t.Fatalf("CreateQueryPlan: %v", err)
+	}
+	if got := rows(t, p, "b"); !slices.Equal(got, []string{"rec10"}) {
+		t.Errorf("got %v, want [rec10]", got)
+	}
+	if got := p.Schema().Fields(); !slices.Equal(got, []string{"b"}) {
+		t.Errorf("schema=%v, want [b]", got)
+	}
+
+	if n := execute(t, db.Planner, tx, "update T1 set B = 'changed' where A = 20"); n != 1 {
+		t.Errorf("update affected %d records, want 1", n)
+	}
+	if n := execute(t, db.Planner, tx, "delete from T1 where B = 'changed'"); n != 1 {
+		t.Errorf("delete affected %d records, want 1", n)
+	}
+	p, err = db.Planner.CreateQueryPlan("select a from t1", tx)
+	if err != nil {
+		t.Fatalf("CreateQueryPlan: %v", err)
+	}
+	if got := len(rows(t, p, "a")); got != 199 {
+		t.Errorf("%d records remain, want 199", got)
+	}
+
+	if _, err := db.Planner.CreateQueryPlan("select a from nosuchtable", tx); err == nil {
+		t.Errorf("CreateQueryPlan on a missing table: no error")
+	}
+	if _, err := db.Planner.ExecuteUpdate("insert into t1 values (1)", tx); err == nil {
+		t.Errorf("ExecuteUpdate with a syntax error: no error")
+	}
+
+	// views referring to themselves
+	execute(t, db.Planner, tx, "create view v as select a from v")
+	execute(t, db.Planner, tx, "create view v1 as select a from t1, v2")
+	execute(t, db.Planner, tx, "create view v2 as select a from v1")
+	basic := plan.NewPlanner(plan.NewBasicQueryPlanner(db.MetadataManager), plan.NewBasicUpdatePlanner(db.MetadataManager))
+	for _, planner := range []*plan.Planner{db.Planner, basic} {
+		for _, sql := range []string{"select a from v", "select a from v2"} {
+			if _, err := planner.CreateQueryPlan(sql, tx); !errors.Is(err, plan.ErrViewCycle) {
+				t.Errorf("CreateQueryPlan(%q): got %v, want ErrViewCycle", sql, err)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("tx.Commit: %v", err)
+	}
+}
+
+func TestPlannerInvalidValues(t *testing.T) {
+	t.Parallel()
+
+	db, err := server.NewSimpleDBWithMetadata(path.Join(t.TempDir(), "invalidvaluetest"), 400, 8)
+	if err != nil {
+		t.Fatalf("server.NewSimpleDBWithMetadata: %v", err)
+	}
+	tx1 := db.NewTx()
+	execute(t, db.Planner, tx1, "create table t (a int, b varchar(5))")
+	execute(t, db.Planner, tx1, "insert into t (a, b) values (1, 'a')")
+	if err := tx1.Commit(); err != nil {
+		t.Fatalf("tx1.Commit: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		cmd  string
+		want error
+	}{
+		{name: "string in int", cmd: "insert into t (a, b) values ('x', 'y')", want: query.ErrTypeMismatch},
+		{name: "int in varchar", cmd: "insert into t (a, b) values (1, 2)", want: query.ErrTypeMismatch},
+		{name: "update with string", cmd: "update t set a = 'x'", want: query.ErrTypeMismatch},
+		{name: "too long", cmd: "insert into t (a, b) values (1, 'abcdefgh')", want: record.ErrValueTooLong},
+		{name: "longer than a block", cmd: fmt.Sprintf("insert into t (a, b) values (1, '%s')", strings.Repeat("x", 300)), want: record.ErrValueTooLong},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := db.NewTx()
+			if _, err := db.Planner.ExecuteUpdate(tt.cmd, tx); !errors.Is(err, tt.want) {
+				t.Errorf("ExecuteUpdate(%q): got %v, want %v", tt.cmd, err, tt.want)
+			}
+			if err := tx.Rollback(); err != nil {
+				t.Fatalf("tx.Rollback: %v", err)
+			}
+		})
+	}
+
+	// the failed statements left nothing behind
+	tx2 := db.NewTx()
+	execute(t, db.Planner, tx2, "insert into t (a, b) values (2, 'abcde')")
+	p, err := db.Planner.CreateQueryPlan("select a, b from t", tx2)
+	if err != nil {
+		t.Fatalf("CreateQueryPlan: %v", err)
+	}
+	if got := rows(t, p, "a", "b"); !slices.Equal(got, []string{"1|a", "2|abcde"}) {
+		t.Errorf("got %v, want [1|a 2|abcde]", got)
+	}
+	if err := tx2.Commit(); err != nil {
+		t.Fatalf("tx2.Commit: %v", err)
+	}
+}
+
+func TestHeuristicQueryPlanner(t *testing.T) {
+	t.Parallel()
+
+	db := setupUniversity(t, path.Join(t.TempDir(), "heuristictest"))
+	tx := db.NewTx()
+	execute(t, db.Planner, tx, "create view mathstudent as select sid, sname from student, dept where majorid = did and dname = 'math'")
+
+	queries := []struct {
+		sql    string
+		fields []string
+		want   int
+	}{
+		{"select sname, dname from student, dept where majorid = did", []string{"sname", "dname"}, 30},
+		{"select sname, grade from enroll, dept, student where sid = studentid and majorid = did and dname = 'drama'", []string{"sname", "grade"}, 20},
+		{"select sname, dname from student, dept where gradyear = 2021", []string{"sname", "dname"}, 8 * 3},
+		{"select sname, grade from mathstudent, enroll where sid = studentid", []string{"sname", "grade"}, 20},
+	}
+	heuristic := db.Planner
+	basic := plan.NewPlanner(
+		plan.NewBasicQueryPlanner(db.MetadataManager),
+		plan.NewBasicUpdatePlanner(db.MetadataManager),
+	)
+	for _, q := range queries {
+		hp, err := heuristic.CreateQueryPlan(q.sql, tx)
+		if err != nil {
+			t.Fatalf("heuristic CreateQueryPlan(%q): %v", q.sql, err)
+		}
+		bp, err := basic.CreateQueryPlan(q.sql, tx)
+		if err != nil {
+			t.Fatalf("basic CreateQueryPlan(%q): %v", q.sql, err)
+		}
+
+		got := rows(t, hp, q.fields...)
+		if len(got) != q.want {
+			t.Errorf("%q: heuristic plan output %d records, want %d", q.sql, len(got), q.want)
+		}
+		want := rows(t, bp, q.fields...)
+		slices.Sort(got)
+		slices.Sort(want)
+		if !slices.Equal(got, want) {
+			t.Errorf("%q: heuristic plan output %v, basic plan output %v", q.sql, got, want)
+		}
+		if hp.BlocksAccessed() > bp.BlocksAccessed() {
+			t.Errorf("%q: heuristic plan accesses %d blocks, more than the basic plan %d", q.sql, hp.BlocksAccessed(), bp.BlocksAccessed())
+		}
+	}
+
+	// a term on an unknown field is not dropped
+	for _, sql := range []string{
+		"select sid from student where nosuch = 1",
+		"select sid from student, dept where majorid = did and nosuch = dname",
+	} {
+		if _, err := heuristic.CreateQueryPlan(sql, tx); !errors.Is(err, query.ErrFieldNotFound) {
+			t.Errorf("%q: got %v, want ErrFieldNotFound", sql, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("tx.Commit: %v", err)
+	}
+}
+
+func TestPlanEstimates(t *testing.T) {
+	t.Parallel()
+
+	db := setupUniversity(t, path.Join(t.TempDir(), "estimatetest"))
+	tx := db.NewTx()
+
+	student, err := plan.NewTablePlan(tx, "student", db.MetadataManager)
+	if err != nil {
+		t.Fatalf("plan.NewTablePlan: %v", err)
+	}
+	dept, err := plan.NewTablePlan(tx, "dept", db.MetadataManager)
+	if err != nil {
+		t.Fatalf("plan.NewTablePlan: %v", err)
+	}
+	if got := student.RecordsOutput(); got != 30 {
+		t.Errorf("student.RecordsOutput()=%d, want 30", got)
+	}
+
+	product := plan.NewProductPlan(student, dept)
+	if got := product.RecordsOutput(); got != 30*3 {
+		t.Errorf("product.RecordsOutput()=%d, want %d", got, 30*3)
+	}
+	wantBlocks := student.BlocksAccessed() + student.RecordsOutput()*dept.BlocksAccessed()
+	if got := product.BlocksAccessed(); got != wantBlocks {
+		t.Errorf("product.BlocksAccessed()=%d, want %d", got, wantBlocks)
+	}
+
+	// the estimates of large products saturate instead of overflowing
+	var large plan.Plan = student
+	for range 7 {
+		large = plan.NewProductPlan(large, student)
+	}
+	if got := large.RecordsOutput(); got != math.MaxInt32 {
+		t.Errorf("large.RecordsOutput()=%d, want %d", got, math.MaxInt32)
+	}
+	if got := large.BlocksAccessed(); got != math.MaxInt32 {
+		t.Errorf("large.BlocksAccessed()=%d, want %d", got, math.MaxInt32)
+	}
+
+	pred := query.NewPredicate(query.NewTerm(query.NewFieldExpression("sid"), query.NewConstantExpression(query.NewIntConstant(3))))
+	sel := plan.NewSelectPlan(student, pred)
+	if got, want := sel.RecordsOutput(), student.RecordsOutput()/student.DistinctValues("sid"); got != want {
+		t.Errorf("sel.RecordsOutput()=%d, want %d", got, want)
+	}
+	if got := sel.DistinctValues("sid"); got != 1 {
+		t.Errorf("sel.DistinctValues(sid)=%d, want 1", got)
+	}
+
+	proj := plan.NewProjectPlan(sel, []string{"sname"})
+	if got := proj.Schema().Fields(); !slices.Equal(got, []string{"sname"}) {
+		t.Errorf("proj.Schema()=%v, want [sname]", got)
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("tx.Commit: %v", err)
+	}
+}
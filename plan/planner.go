@@ -0,0 +1,66 @@
+package plan
+
+import (
+	"ddai-go/parse"
+	"ddai-go/tx"
+	"fmt"
+)
+
+// QueryPlanner creates a plan for a select statement.
+type QueryPlanner interface {
+	CreatePlan(data *parse.QueryData, tx *tx.Transaction) (Plan, error)
+}
+
+// UpdatePlanner executes update commands, and returns the number of affected records.
+type UpdatePlanner interface {
+	ExecuteInsert(data *parse.InsertData, tx *tx.Transaction) (int, error)
+	ExecuteDelete(data *parse.DeleteData, tx *tx.Transaction) (int, error)
+	ExecuteModify(data *parse.ModifyData, tx *tx.Transaction) (int, error)
+	ExecuteCreateTable(data *parse.CreateTableData, tx *tx.Transaction) (int, error)
+	ExecuteCreateView(data *parse.CreateViewData, tx *tx.Transaction) (int, error)
+	ExecuteCreateIndex(data *parse.CreateIndexData, tx *tx.Transaction) (int, error)
+}
+
+// Planner parses SQL statements and passes them to the query planner or the update planner.
+type Planner struct {
+	queryPlanner  QueryPlanner
+	updatePlanner UpdatePlanner
+}
+
+func NewPlanner(queryPlanner QueryPlanner, updatePlanner UpdatePlanner) *Planner {
+	return &Planner{
+		queryPlanner:  queryPlanner,
+		updatePlanner: updatePlanner,
+	}
+}
+
+func (p *Planner) CreateQueryPlan(cmd string, tx *tx.Transaction) (Plan, error) {
+	data, err := parse.NewParser(cmd).Query()
+	if err != nil {
+		return nil, fmt.Errorf("parse: %w", err)
+	}
+	return p.queryPlanner.CreatePlan(data, tx)
+}
+
+func (p *Planner) ExecuteUpdate(cmd string, tx *tx.Transaction) (int, error) {
+	stmt, err := parse.NewParser(cmd).UpdateCmd()
+	if err != nil {
+		return 0, fmt.Errorf("parse: %w", err)
+	}
+	switch data := stmt.(type) {
+	case *parse.InsertData:
+		return p.updatePlanner.ExecuteInsert(data, tx)
+	case *parse.DeleteData:
+		return p.updatePlanner.ExecuteDelete(data, tx)
+	case *parse.ModifyData:
+		return p.updatePlanner.ExecuteModify(data, tx)
+	case *parse.CreateTableData:
+		return p.updatePlanner.ExecuteCreateTable(data, tx)
+	case *parse.CreateViewData:
+		return p.updatePlanner.ExecuteCreateView(data, tx)
+	case *parse.CreateIndexData:
+		return p.updatePlanner.ExecuteCreateIndex(data, tx)
+	default:
+		return 0, fmt.Errorf("unsupported statement %T", stmt)
+	}
+}
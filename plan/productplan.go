@@ -0,0 +1,65 @@
+package plan
+
+import (
+	"ddai-go/query"
+	"ddai-go/record"
+	"math"
+)
+
+var _ Plan = (*ProductPlan)(nil)
+
+// ProductPlan is the plan of the product operator.
+type ProductPlan struct {
+	p1     Plan
+	p2     Plan
+	schema *record.Schema
+}
+
+func NewProductPlan(p1 Plan, p2 Plan) *ProductPlan {
+	schema := record.NewSchema()
+	schema.AddAll(p1.Schema())
+	schema.AddAll(p2.Schema())
+	return &ProductPlan{p1: p1, p2: p2, schema: schema}
+}
+
+func (pp *ProductPlan) Open() (query.Scan, error) {
+	s1, err := pp.p1.Open()
+	if err != nil {
+		return nil, err
+	}
+	s2, err := pp.p2.Open()
+	if err != nil {
+		s1.Close()
+		return nil, err
+	}
+	ps, err := query.NewProductScan(s1, s2)
+	if err != nil {
+		s1.Close()
+		s2.Close()
+		return nil, err
+	}
+	return ps, nil
+}
+
+// BlocksAccessed estimates that the right side is scanned once for each record of the left side.
+// The estimate saturates at math.MaxInt32.
+func (pp *ProductPlan) BlocksAccessed() int32 {
+	blocks := int64(pp.p1.BlocksAccessed()) + int64(pp.p1.RecordsOutput())*int64(pp.p2.BlocksAccessed())
+	return int32(min(blocks, math.MaxInt32))
+}
+
+// RecordsOutput saturates at math.MaxInt32.
+func (pp *ProductPlan) RecordsOutput() int32 {
+	return int32(min(int64(pp.p1.RecordsOutput())*int64(pp.p2.RecordsOutput()), math.MaxInt32))
+}
+
+func (pp *ProductPlan) DistinctValues(fldname string) int32 {
+	if pp.p1.Schema().HasField(fldname) {
+		return pp.p1.DistinctValues(fldname)
+	}
+	return pp.p2.DistinctValues(fldname)
+}
+
+func (pp *ProductPlan) Schema() *record.Schema {
+	return pp.schema
+}
@@ -0,0 +1,46 @@
+package plan
+
+import (
+	"ddai-go/query"
+	"ddai-go/record"
+)
+
+var _ Plan = (*ProjectPlan)(nil)
+
+// ProjectPlan is the plan of the project operator.
+type ProjectPlan struct {
+	p      Plan
+	schema *record.Schema
+}
+
+func NewProjectPlan(p Plan, fields []string) *ProjectPlan {
+	schema := record.NewSchema()
+	for _, fldname := range fields {
+		schema.Add(fldname, p.Schema())
+	}
+	return &ProjectPlan{p: p, schema: schema}
+}
+
+func (pp *ProjectPlan) Open() (query.Scan, error) {
+	s, err := pp.p.Open()
+	if err != nil {
+		return nil, err
+	}
+	return query.NewProjectScan(s, pp.schema.Fields()), nil
+}
+
+func (pp *ProjectPlan) BlocksAccessed() int32 {
+	return pp.p.BlocksAccessed()
+}
+
+func (pp *ProjectPlan) RecordsOutput() int32 {
+	return pp.p.RecordsOutput()
+}
+
+func (pp *ProjectPlan) DistinctValues(fldname string) int32 {
+	return pp.p.DistinctValues(fldname)
+}
+
+func (pp *ProjectPlan) Schema() *record.Schema {
+	return pp.schema
+}
@@ -0,0 +1,48 @@
+package plan
+
+import (
+	"ddai-go/query"
+	"ddai-go/record"
+)
+
+var _ Plan = (*SelectPlan)(nil)
+
+// SelectPlan is the plan of the select operator.
+type SelectPlan struct {
+	p    Plan
+	pred *query.Predicate
+}
+
+func NewSelectPlan(p Plan, pred *query.Predicate) *SelectPlan {
+	return &SelectPlan{p: p, pred: pred}
+}
+
+func (sp *SelectPlan) Open() (query.Scan, error) {
+	s, err := sp.p.Open()
+	if err != nil {
+		return nil, err
+	}
+	return query.NewSelectScan(s, sp.pred), nil
+}
+
+func (sp *SelectPlan) BlocksAccessed() int32 {
+	return sp.p.BlocksAccessed()
+}
+
+func (sp *SelectPlan) RecordsOutput() int32 {
+	return sp.p.RecordsOutput() / max(sp.pred.ReductionFactor(sp.p), 1)
+}
+
+func (sp *SelectPlan) DistinctValues(fldname string) int32 {
+	if _, ok := sp.pred.EquatesWithConstant(fldname); ok {
+		return 1
+	}
+	if fldname2, ok := sp.pred.EquatesWithField(fldname); ok {
+		return min(sp.p.DistinctValues(fldname), sp.p.DistinctValues(fldname2))
+	}
+	return sp.p.DistinctValues(fldname)
+}
+
+func (sp *SelectPlan) Schema() *record.Schema {
+	return sp.p.Schema()
+}
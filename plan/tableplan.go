@@ -0,0 +1,56 @@
+package plan
+
+import (
+	"ddai-go/metadata"
+	"ddai-go/query"
+	"ddai-go/record"
+	"ddai-go/tx"
+	"fmt"
+)
+
+var _ Plan = (*TablePlan)(nil)
+
+// TablePlan is the plan of a stored table.
+type TablePlan struct {
+	tx      *tx.Transaction
+	tblname string
+	layout  *record.Layout
+	si      metadata.StatInfo
+}
+
+func NewTablePlan(tx *tx.Transaction, tblname string, mdm *metadata.MetadataMgr) (*TablePlan, error) {
+	layout, err := mdm.GetLayout(tblname, tx)
+	if err != nil {
+		return nil, fmt.Errorf("mdm.GetLayout: %w", err)
+	}
+	si, err := mdm.GetStatInfo(tblname, layout, tx)
+	if err != nil {
+		return nil, fmt.Errorf("mdm.GetStatInfo: %w", err)
+	}
+	return &TablePlan{
+		tx:      tx,
+		tblname: tblname,
+		layout:  layout,
+		si:      si,
+	}, nil
+}
+
+func (p *TablePlan) Open() (query.Scan, error) {
+	return query.NewTableScan(p.tx, p.tblname, p.layout)
+}
+
+func (p *TablePlan) BlocksAccessed() int32 {
+	return p.si.BlocksAccessed()
+}
+
+func (p *TablePlan) RecordsOutput() int32 {
+	return p.si.RecordsOutput()
+}
+
+func (p *TablePlan) DistinctValues(fldname string) int32 {
+	return p.si.DistinctValues(fldname)
+}
+
+func (p *TablePlan) Schema() *record.Schema {
+	return p.layout.Schema()
+}
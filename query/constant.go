@@ -0,0 +1,58 @@
+package query
+
+import (
+	"cmp"
+	"ddai-go/record"
+	"strconv"
+)
+
+// Constant is a value stored in a field, either an int32 or a string.
+// Constants are comparable with ==, so that they can be used as map keys.
+type Constant struct {
+	typ  record.FieldType
+	ival int32
+	sval string
+}
+
+func NewIntConstant(val int32) Constant {
+	return Constant{typ: record.Integer, ival: val}
+}
+
+func NewStringConstant(val string) Constant {
+	return Constant{typ: record.Varchar, sval: val}
+}
+
+func (c Constant) Type() record.FieldType {
+	return c.typ
+}
+
+func (c Constant) AsInt() int32 {
+	return c.ival
+}
+
+func (c Constant) AsString() string {
+	return c.sval
+}
+
+func (c Constant) Equals(other Constant) bool {
+	return c == other
+}
+
+// CompareTo compares two constants.
+// Integers are ordered before strings, so that constants of different types can still be sorted.
+func (c Constant) CompareTo(other Constant) int {
+	if c.typ != other.typ {
+		return cmp.Compare(c.typ, other.typ)
+	}
+	if c.typ == record.Integer {
+		return cmp.Compare(c.ival, other.ival)
+	}
+	return cmp.Compare(c.sval, other.sval)
+}
+
+func (c Constant) String() string {
+	if c.typ == record.Integer {
+		return strconv.Itoa(int(c.ival))
+	}
+	return c.sval
+}
@@ -0,0 +1,233 @@
+package query
+
+import (
+	"ddai-go/record"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// DistinctValuer estimates the number of distinct values of a field, which is implemented by query plans.
+type DistinctValuer interface {
+	DistinctValues(fldname string) int32
+}
+
+// Expression is either a constant or a field name.
+type Expression struct {
+	val     *Constant // nil if the expression is a field name
+	fldname string
+}
+
+func NewConstantExpression(val Constant) Expression {
+	return Expression{val: &val}
+}
+
+func NewFieldExpression(fldname string) Expression {
+	return Expression{fldname: fldname}
+}
+
+func (e Expression) IsFieldName() bool {
+	return e.val == nil
+}
+
+func (e Expression) AsConstant() Constant {
+	return *e.val
+}
+
+func (e Expression) AsFieldName() string {
+	return e.fldname
+}
+
+// Evaluate returns the value of the expression for the current record of the scan.
+func (e Expression) Evaluate(s Scan) (Constant, error) {
+	if e.IsFieldName() {
+		return s.GetVal(e.fldname)
+	}
+	return *e.val, nil
+}
+
+// AppliesTo returns true if the expression can be evaluated by a scan having the schema.
+func (e Expression) AppliesTo(sch *record.Schema) bool {
+	return !e.IsFieldName() || sch.HasField(e.fldname)
+}
+
+func (e Expression) String() string {
+	if e.IsFieldName() {
+		return e.fldname
+	}
+	return e.val.String()
+}
+
+// Term is a comparison of two expressions for equality.
+type Term struct {
+	lhs Expression
+	rhs Expression
+}
+
+func NewTerm(lhs Expression, rhs Expression) Term {
+	return Term{lhs: lhs, rhs: rhs}
+}
+
+func (t Term) IsSatisfied(s Scan) (bool, error) {
+	lhsVal, err := t.lhs.Evaluate(s)
+	if err != nil {
+		return false, err
+	}
+	rhsVal, err := t.rhs.Evaluate(s)
+	if err != nil {
+		return false, err
+	}
+	return lhsVal.Equals(rhsVal), nil
+}
+
+// EquatesWithConstant returns the constant if the term is of the form "F=c", where F is the field.
+func (t Term) EquatesWithConstant(fldname string) (Constant, bool) {
+	if t.lhs.IsFieldName() && t.lhs.AsFieldName() == fldname && !t.rhs.IsFieldName() {
+		return t.rhs.AsConstant(), true
+	}
+	if t.rhs.IsFieldName() && t.rhs.AsFieldName() == fldname && !t.lhs.IsFieldName() {
+		return t.lhs.AsConstant(), true
+	}
+	return Constant{}, false
+}
+
+// EquatesWithField returns the other field name if the term is of the form "F1=F2", where F1 is the field.
+func (t Term) EquatesWithField(fldname string) (string, bool) {
+	if t.lhs.IsFieldName() && t.lhs.AsFieldName() == fldname && t.rhs.IsFieldName() {
+		return t.rhs.AsFieldName(), true
+	}
+	if t.rhs.IsFieldName() && t.rhs.AsFieldName() == fldname && t.lhs.IsFieldName() {
+		return t.lhs.AsFieldName(), true
+	}
+	return "", false
+}
+
+// ReductionFactor estimates by how much the term reduces the number of records output by the plan.
+func (t Term) ReductionFactor(p DistinctValuer) int32 {
+	switch {
+	case t.lhs.IsFieldName() && t.rhs.IsFieldName():
+		return max(p.DistinctValues(t.lhs.AsFieldName()), p.DistinctValues(t.rhs.AsFieldName()))
+	case t.lhs.IsFieldName():
+		return p.DistinctValues(t.lhs.AsFieldName())
+	case t.rhs.IsFieldName():
+		return p.DistinctValues(t.rhs.AsFieldName())
+	case t.lhs.AsConstant().Equals(t.rhs.AsConstant()):
+		return 1
+	default:
+		return math.MaxInt32
+	}
+}
+
+func (t Term) AppliesTo(sch *record.Schema) bool {
+	return t.lhs.AppliesTo(sch) && t.rhs.AppliesTo(sch)
+}
+
+func (t Term) String() string {
+	return t.lhs.String() + "=" + t.rhs.String()
+}
+
+// Predicate is a conjunction of terms. An empty predicate is always satisfied.
+type Predicate struct {
+	terms []Term
+}
+
+func NewPredicate(terms ...Term) *Predicate {
+	return &Predicate{terms: terms}
+}
+
+// ConjoinWith adds the terms of the other predicate to this predicate.
+func (p *Predicate) ConjoinWith(pred *Predicate) {
+	p.terms = append(p.terms, pred.terms...)
+}
+
+func (p *Predicate) IsSatisfied(s Scan) (bool, error) {
+	for _, t := range p.terms {
+		ok, err := t.IsSatisfied(s)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// ReductionFactor estimates by how much the predicate reduces the number of records output by the plan.
+// The factor saturates at math.MaxInt32.
+func (p *Predicate) ReductionFactor(plan DistinctValuer) int32 {
+	factor := int64(1)
+	for _, t := range p.terms {
+		factor = min(factor*int64(t.ReductionFactor(plan)), math.MaxInt32)
+	}
+	return int32(factor)
+}
+
+// CheckFields returns an error wrapping ErrFieldNotFound if a term refers to a field that is not in the schema.
+func (p *Predicate) CheckFields(sch *record.Schema) error {
+	for _, t := range p.terms {
+		for _, e := range []Expression{t.lhs, t.rhs} {
+			if e.IsFieldName() && !sch.HasField(e.AsFieldName()) {
+				return fmt.Errorf("%s: %w", e.AsFieldName(), ErrFieldNotFound)
+			}
+		}
+	}
+	return nil
+}
+
+// SelectSubPred returns the sub-predicate that applies to the schema, or nil if there is none.
+func (p *Predicate) SelectSubPred(sch *record.Schema) *Predicate {
+	result := NewPredicate()
+	for _, t := range p.terms {
+		if t.AppliesTo(sch) {
+			result.terms = append(result.terms, t)
+		}
+	}
+	if len(result.terms) == 0 {
+		return nil
+	}
+	return result
+}
+
+// JoinSubPred returns the sub-predicate that applies to the union of the two schemas but not to either of them,
+// or nil if there is none.
+func (p *Predicate) JoinSubPred(sch1 *record.Schema, sch2 *record.Schema) *Predicate {
+	newSch := record.NewSchema()
+	newSch.AddAll(sch1)
+	newSch.AddAll(sch2)
+	result := NewPredicate()
+	for _, t := range p.terms {
+		if !t.AppliesTo(sch1) && !t.AppliesTo(sch2) && t.AppliesTo(newSch) {
+			result.terms = append(result.terms, t)
+		}
+	}
+	if len(result.terms) == 0 {
+		return nil
+	}
+	return result
+}
+
+// EquatesWithConstant returns the constant if there is a term of the form "F=c", where F is the field.
+func (p *Predicate) EquatesWithConstant(fldname string) (Constant, bool) {
+	for _, t := range p.terms {
+		if c, ok := t.EquatesWithConstant(fldname); ok {
+			return c, true
+		}
+	}
+	return Constant{}, false
+}
+
+// EquatesWithField returns the other field name if there is a term of the form "F1=F2", where F1 is the field.
+func (p *Predicate) EquatesWithField(fldname string) (string, bool) {
+	for _, t := range p.terms {
+		if s, ok := t.EquatesWithField(fldname); ok {
+			return s, true
+		}
+	}
+	return "", false
+}
+
+func (p *Predicate) String() string {
+	terms := make([]string, len(p.terms))
+	for i, t := range p.terms {
+		terms[i] = t.String()
+	}
+	return strings.Join(terms, " and ")
+}
@@ -0,0 +1,80 @@
+package query
+
+import "errors"
+
+var _ Scan = (*ProductScan)(nil)
+
+// ProductScan outputs every combination of the records of the two underlying scans.
+// The second scan is iterated once for each record of the first scan.
+type ProductScan struct {
+	s1      Scan
+	s2      Scan
+	hasLeft bool // true if s1 is positioned on a record
+}
+
+func NewProductScan(s1 Scan, s2 Scan) (*ProductScan, error) {
+	ps := &ProductScan{s1: s1, s2: s2}
+	if err := ps.BeforeFirst(); err != nil {
+		return nil, err
+	}
+	return ps, nil
+}
+
+func (ps *ProductScan) BeforeFirst() error {
+	if err := ps.s1.BeforeFirst(); err != nil {
+		return err
+	}
+	ok, err := ps.s1.Next()
+	if err != nil {
+		return err
+	}
+	ps.hasLeft = ok
+	return ps.s2.BeforeFirst()
+}
+
+func (ps *ProductScan) Next() (bool, error) {
+	for ps.hasLeft {
+		ok, err := ps.s2.Next()
+		if err != nil || ok {
+			return ok, err
+		}
+		// s2 is exhausted, so move s1 to its next record and restart s2
+		if err := ps.s2.BeforeFirst(); err != nil {
+			return false, err
+		}
+		ps.hasLeft, err = ps.s1.Next()
+		if err != nil {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+func (ps *ProductScan) GetInt(fldname string) (int32, error) {
+	if ps.s1.HasField(fldname) {
+		return ps.s1.GetInt(fldname)
+	}
+	return ps.s2.GetInt(fldname)
+}
+
+func (ps *ProductScan) GetString(fldname string) (string, error) {
+	if ps.s1.HasField(fldname) {
+		return ps.s1.GetString(fldname)
+	}
+	return ps.s2.GetString(fldname)
+}
+
+func (ps *ProductScan) GetVal(fldname string) (Constant, error) {
+	if ps.s1.HasField(fldname) {
+		return ps.s1.GetVal(fldname)
+	}
+	return ps.s2.GetVal(fldname)
+}
+
+func (ps *ProductScan) HasField(fldname string) bool {
+	return ps.s1.HasField(fldname) || ps.s2.HasField(fldname)
+}
+
+func (ps *ProductScan) Close() error {
+	return errors.Join(ps.s1.Close(), ps.s2.Close())
+}
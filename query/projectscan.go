@@ -0,0 +1,55 @@
+package query
+
+import (
+	"fmt"
+	"slices"
+)
+
+var _ Scan = (*ProjectScan)(nil)
+
+// ProjectScan outputs only the specified fields of the underlying scan.
+type ProjectScan struct {
+	s      Scan
+	fields []string
+}
+
+func NewProjectScan(s Scan, fields []string) *ProjectScan {
+	return &ProjectScan{s: s, fields: fields}
+}
+
+func (ps *ProjectScan) BeforeFirst() error {
+	return ps.s.BeforeFirst()
+}
+
+func (ps *ProjectScan) Next() (bool, error) {
+	return ps.s.Next()
+}
+
+func (ps *ProjectScan) GetInt(fldname string) (int32, error) {
+	if !ps.HasField(fldname) {
+		return 0, fmt.Errorf("%s: %w", fldname, ErrFieldNotFound)
+	}
+	return ps.s.GetInt(fldname)
+}
+
+func (ps *ProjectScan) GetString(fldname string) (string, error) {
+	if !ps.HasField(fldname) {
+		return "", fmt.Errorf("%s: %w", fldname, ErrFieldNotFound)
+	}
+	return ps.s.GetString(fldname)
+}
+
+func (ps *ProjectScan) GetVal(fldname string) (Constant, error) {
+	if !ps.HasField(fldname) {
+		return Constant{}, fmt.Errorf("%s: %w", fldname, ErrFieldNotFound)
+	}
+	return ps.s.GetVal(fldname)
+}
+
+func (ps *ProjectScan) HasField(fldname string) bool {
+	return slices.Contains(ps.fields, fldname)
+}
+
+func (ps *ProjectScan) Close() error {
+	return ps.s.Close()
+}
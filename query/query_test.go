@@ -0,0 +1,282 @@
+package query_test
+
+import (
+	"ddai-go/query"
+	"ddai-go/record"
+	"ddai-go/server"
+	"ddai-go/tx"
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"testing"
+)
+
+func TestConstant(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		c1, c2 query.Constant
+		want   int
+	}{
+		{query.NewIntConstant(1), query.NewIntConstant(1), 0},
+		{query.NewIntConstant(-1), query.NewIntConstant(1), -1},
+		{query.NewStringConstant("b"), query.NewStringConstant("a"), 1},
+		{query.NewIntConstant(100), query.NewStringConstant("1"), -1},
+		{query.NewStringConstant(""), query.NewIntConstant(0), 1},
+	}
+	for _, tt := range tests {
+		if got := tt.c1.CompareTo(tt.c2); got != tt.want {
+			t.Errorf("%v.CompareTo(%v)=%d, want %d", tt.c1, tt.c2, got, tt.want)
+		}
+		if got := tt.c1.Equals(tt.c2); got != (tt.want == 0) {
+			t.Errorf("%v.Equals(%v)=%v, want %v", tt.c1, tt.c2, got, tt.want == 0)
+		}
+	}
+}
+
+// createTable inserts n records {A: i, B: "rec<i>"} into the table, whose fields are prefixed with prefix.
+func createTable(t *testing.T, tx *tx.Transaction, tblname string, prefix string, n int32) *record.Layout {
+	t.Helper()
+
+	sch := record.NewSchema()
+	sch.AddIntField(prefix + "A")
+	sch.AddStringField(prefix+"B", 9)
+	layout := record.NewLayout(sch)
+
+	ts, err := query.NewTableScan(tx, tblname, layout)
+	if err != nil {
+		t.Fatalf("query.NewTableScan: %v", err)
+	}
+	defer ts.Close()
+	for i := range n {
+		if err := ts.Insert(); err != nil {
+			t.Fatalf("ts.Insert: %v", err)
+		}
+		if err := ts.SetVal(prefix+"A", query.NewIntConstant(i)); err != nil {
+			t.Fatalf("ts.SetVal: %v", err)
+		}
+		if err := ts.SetVal(prefix+"B", query.NewStringConstant(fmt.Sprintf("rec%d", i))); err != nil {
+			t.Fatalf("ts.SetVal: %v", err)
+		}
+	}
+	return layout
+}
+
+func collect(t *testing.T, s query.Scan, fldname string) []query.Constant {
+	t.Helper()
+
+	var vals []query.Constant
+	if err := s.BeforeFirst(); err != nil {
+		t.Fatalf("s.BeforeFirst: %v", err)
+	}
+	for {
+		ok, err := s.Next()
+		if err != nil {
+			t.Fatalf("s.Next: %v", err)
+		}
+		if !ok {
+			return vals
+		}
+		v, err := s.GetVal(fldname)
+		if err != nil {
+			t.Fatalf("s.GetVal: %v", err)
+		}
+		vals = append(vals, v)
+	}
+}
+
+func TestSelectProjectScan(t *testing.T) {
+	t.Parallel()
+
+	db, err := server.NewSimpleDB(path.Join(t.TempDir(), "scantest1"), 400, 8)
+	if err != nil {
+		t.Fatalf("server.NewSimpleDB: %v", err)
+	}
+	tx := db.NewTx()
+	layout := createTable(t, tx, "T", "", 200)
+
+	s1, err := query.NewTableScan(tx, "T", layout)
+	if err != nil {
+		t.Fatalf("query.NewTableScan: %v", err)
+	}
+	// select B from T where A = 10
+	term := query.NewTerm(query.NewFieldExpression("A"), query.NewConstantExpression(query.NewIntConstant(10)))
+	s2 := query.NewSelectScan(s1, query.NewPredicate(term))
+	s3 := query.NewProjectScan(s2, []string{"B"})
+
+	got := collect(t, s3, "B")
+	if want := []query.Constant{query.NewStringConstant("rec10")}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if _, err := s3.GetVal("A"); !errors.Is(err, query.ErrFieldNotFound) {
+		t.Errorf("s3.GetVal(A) err=%v, want ErrFieldNotFound", err)
+	}
+
+	// delete through the select scan
+	if err := s2.BeforeFirst(); err != nil {
+		t.Fatalf("s2.BeforeFirst: %v", err)
+	}
+	for {
+		ok, err := s2.Next()
+		if err != nil {
+			t.Fatalf("s2.Next: %v", err)
+		}
+		if !ok {
+			break
+		}
+		if err := s2.Delete(); err != nil {
+			t.Fatalf("s2.Delete: %v", err)
+		}
+	}
+	if got := collect(t, s3, "B"); len(got) != 0 {
+		t.Errorf("got %v after delete, want none", got)
+	}
+	if got := collect(t, s1, "A"); len(got) != 199 {
+		t.Errorf("%d records remain, want 199", len(got))
+	}
+
+	// the fields and their types are checked
+	if err := s1.BeforeFirst(); err != nil {
+		t.Fatalf("s1.BeforeFirst: %v", err)
+	}
+	if ok, err := s1.Next(); err != nil || !ok {
+		t.Fatalf("s1.Next()=(%v, %v), want true", ok, err)
+	}
+	if err := s1.SetInt("nosuch", 0); !errors.Is(err, query.ErrFieldNotFound) {
+		t.Errorf("s1.SetInt(nosuch) err=%v, want ErrFieldNotFound", err)
+	}
+	if _, err := s1.GetString("nosuch"); !errors.Is(err, query.ErrFieldNotFound) {
+		t.Errorf("s1.GetString(nosuch) err=%v, want ErrFieldNotFound", err)
+	}
+	if err := s1.SetString("A", "rec"); !errors.Is(err, query.ErrTypeMismatch) {
+		t.Errorf("s1.SetString(A) err=%v, want ErrTypeMismatch", err)
+	}
+	if _, err := s1.GetInt("B"); !errors.Is(err, query.ErrTypeMismatch) {
+		t.Errorf("s1.GetInt(B) err=%v, want ErrTypeMismatch", err)
+	}
+	if got := collect(t, s1, "A"); len(got) != 199 {
+		t.Errorf("%d records remain after invalid updates, want 199", len(got))
+	}
+
+	// a select scan is updatable only if its input is
+	if _, err := s2.GetRID(); err != nil {
+		t.Errorf("s2.GetRID: %v", err)
+	}
+	if _, err := query.NewSelectScan(s3, query.NewPredicate(term)).GetRID(); !errors.Is(err, query.ErrNotUpdatable) {
+		t.Errorf("GetRID of a select on a project scan err=%v, want ErrNotUpdatable", err)
+	}
+	if err := s3.Close(); err != nil {
+		t.Fatalf("s3.Close: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("tx.Commit: %v", err)
+	}
+}
+
+func TestProductScan(t *testing.T) {
+	t.Parallel()
+
+	db, err := server.NewSimpleDB(path.Join(t.TempDir(), "scantest2"), 400, 8)
+	if err != nil {
+		t.Fatalf("server.NewSimpleDB: %v", err)
+	}
+	tx := db.NewTx()
+	layout1 := createTable(t, tx, "T1", "", 20)
+	layout2 := createTable(t, tx, "T2", "C", 30)
+	layoutEmpty := createTable(t, tx, "T3", "D", 0)
+
+	s1, err := query.NewTableScan(tx, "T1", layout1)
+	if err != nil {
+		t.Fatalf("query.NewTableScan: %v", err)
+	}
+	s2, err := query.NewTableScan(tx, "T2", layout2)
+	if err != nil {
+		t.Fatalf("query.NewTableScan: %v", err)
+	}
+	s3, err := query.NewProductScan(s1, s2)
+	if err != nil {
+		t.Fatalf("query.NewProductScan: %v", err)
+	}
+	if got := collect(t, s3, "CB"); len(got) != 20*30 {
+		t.Errorf("product has %d records, want %d", len(got), 20*30)
+	}
+
+	// select B, CB from T1, T2 where A = CA
+	term := query.NewTerm(query.NewFieldExpression("A"), query.NewFieldExpression("CA"))
+	s4 := query.NewProjectScan(query.NewSelectScan(s3, query.NewPredicate(term)), []string{"B", "CB"})
+	got := collect(t, s4, "CB")
+	if len(got) != 20 {
+		t.Fatalf("join has %d records, want 20", len(got))
+	}
+	for i, v := range got {
+		if want := query.NewStringConstant(fmt.Sprintf("rec%d", i)); v != want {
+			t.Errorf("record %d: CB=%v, want %v", i, v, want)
+		}
+	}
+	if err := s4.Close(); err != nil {
+		t.Fatalf("s4.Close: %v", err)
+	}
+
+	// the product with an empty table is empty, whichever side it is on
+	for _, order := range []string{"left", "right"} {
+		sa, err := query.NewTableScan(tx, "T1", layout1)
+		if err != nil {
+			t.Fatalf("query.NewTableScan: %v", err)
+		}
+		sb, err := query.NewTableScan(tx, "T3", layoutEmpty)
+		if err != nil {
+			t.Fatalf("query.NewTableScan: %v", err)
+		}
+		var ps *query.ProductScan
+		if order == "left" {
+			ps, err = query.NewProductScan(sb, sa)
+		} else {
+			ps, err = query.NewProductScan(sa, sb)
+		}
+		if err != nil {
+			t.Fatalf("query.NewProductScan: %v", err)
+		}
+		if got := collect(t, ps, "A"); len(got) != 0 {
+			t.Errorf("empty table on the %s: got %d records, want 0", order, len(got))
+		}
+		if err := ps.Close(); err != nil {
+			t.Fatalf("ps.Close: %v", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("tx.Commit: %v", err)
+	}
+}
+
+func TestPredicate(t *testing.T) {
+	t.Parallel()
+
+	sch1 := record.NewSchema()
+	sch1.AddIntField("A")
+	sch2 := record.NewSchema()
+	sch2.AddIntField("B")
+
+	c := query.NewIntConstant(3)
+	pred := query.NewPredicate(
+		query.NewTerm(query.NewFieldExpression("A"), query.NewConstantExpression(c)),
+		query.NewTerm(query.NewFieldExpression("A"), query.NewFieldExpression("B")),
+	)
+	if got := pred.SelectSubPred(sch1).String(); got != "A=3" {
+		t.Errorf("pred.SelectSubPred(sch1)=%q, want \"A=3\"", got)
+	}
+	if got := pred.SelectSubPred(sch2); got != nil {
+		t.Errorf("pred.SelectSubPred(sch2)=%v, want nil", got)
+	}
+	if got := pred.JoinSubPred(sch1, sch2).String(); got != "A=B" {
+		t.Errorf("pred.JoinSubPred=%q, want \"A=B\"", got)
+	}
+	if got, ok := pred.EquatesWithConstant("A"); !ok || got != c {
+		t.Errorf("pred.EquatesWithConstant(A)=(%v, %v), want (%v, true)", got, ok, c)
+	}
+	if got, ok := pred.EquatesWithField("B"); !ok || got != "A" {
+		t.Errorf("pred.EquatesWithField(B)=(%q, %v), want (\"A\", true)", got, ok)
+	}
+}
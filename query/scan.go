@@ -0,0 +1,38 @@
+package query
+
+import (
+	"ddai-go/record"
+	"errors"
+)
+
+var (
+	ErrFieldNotFound = errors.New("field not found")
+	ErrNotUpdatable  = errors.New("scan is not updatable")
+	ErrTypeMismatch  = errors.New("value does not match the field type")
+)
+
+// Scan is implemented by each relational operator to iterate over its output records.
+type Scan interface {
+	// BeforeFirst positions the scan before its first record.
+	BeforeFirst() error
+	// Next moves to the next record, and returns false if there is no next record.
+	Next() (bool, error)
+	GetInt(fldname string) (int32, error)
+	GetString(fldname string) (string, error)
+	GetVal(fldname string) (Constant, error)
+	HasField(fldname string) bool
+	// Close releases the blocks pinned by the scan.
+	Close() error
+}
+
+// UpdateScan is a scan whose records can be modified.
+type UpdateScan interface {
+	Scan
+	SetInt(fldname string, val int32) error
+	SetString(fldname string, val string) error
+	SetVal(fldname string, val Constant) error
+	Insert() error
+	Delete() error
+	GetRID() (record.RID, error)
+	MoveToRID(rid record.RID) error
+}
@@ -0,0 +1,112 @@
+package query
+
+import "ddai-go/record"
+
+var _ UpdateScan = (*SelectScan)(nil)
+
+// SelectScan outputs the records of the underlying scan that satisfy the predicate.
+// It is updatable if the underlying scan is updatable.
+type SelectScan struct {
+	s    Scan
+	pred *Predicate
+}
+
+func NewSelectScan(s Scan, pred *Predicate) *SelectScan {
+	return &SelectScan{s: s, pred: pred}
+}
+
+func (ss *SelectScan) BeforeFirst() error {
+	return ss.s.BeforeFirst()
+}
+
+func (ss *SelectScan) Next() (bool, error) {
+	for {
+		ok, err := ss.s.Next()
+		if err != nil || !ok {
+			return false, err
+		}
+		satisfied, err := ss.pred.IsSatisfied(ss.s)
+		if err != nil {
+			return false, err
+		}
+		if satisfied {
+			return true, nil
+		}
+	}
+}
+
+func (ss *SelectScan) GetInt(fldname string) (int32, error) {
+	return ss.s.GetInt(fldname)
+}
+
+func (ss *SelectScan) GetString(fldname string) (string, error) {
+	return ss.s.GetString(fldname)
+}
+
+func (ss *SelectScan) GetVal(fldname string) (Constant, error) {
+	return ss.s.GetVal(fldname)
+}
+
+func (ss *SelectScan) HasField(fldname string) bool {
+	return ss.s.HasField(fldname)
+}
+
+func (ss *SelectScan) Close() error {
+	return ss.s.Close()
+}
+
+func (ss *SelectScan) SetInt(fldname string, val int32) error {
+	us, ok := ss.s.(UpdateScan)
+	if !ok {
+		return ErrNotUpdatable
+	}
+	return us.SetInt(fldname, val)
+}
+
+func (ss *SelectScan) SetString(fldname string, val string) error {
+	us, ok := ss.s.(UpdateScan)
+	if !ok {
+		return ErrNotUpdatable
+	}
+	return us.SetString(fldname, val)
+}
+
+func (ss *SelectScan) SetVal(fldname string, val Constant) error {
+	us, ok := ss.s.(UpdateScan)
+	if !ok {
+		return ErrNotUpdatable
+	}
+	return us.SetVal(fldname, val)
+}
+
+func (ss *SelectScan) Insert() error {
+	us, ok := ss.s.(UpdateScan)
+	if !ok {
+		return ErrNotUpdatable
+	}
+	return us.Insert()
+}
+
+func (ss *SelectScan) Delete() error {
+	us, ok := ss.s.(UpdateScan)
+	if !ok {
+		return ErrNotUpdatable
+	}
+	return us.Delete()
+}
+
+func (ss *SelectScan) GetRID() (record.RID, error) {
+	us, ok := ss.s.(UpdateScan)
+	if !ok {
+		return record.RID{}, ErrNotUpdatable
+	}
+	return us.GetRID()
+}
+
+func (ss *SelectScan) MoveToRID(rid record.RID) error {
+	us, ok := ss.s.(UpdateScan)
+	if !ok {
+		return ErrNotUpdatable
+	}
+	return us.MoveToRID(rid)
+}
@@ -0,0 +1,100 @@
+package query
+
+import (
+	"ddai-go/record"
+	"ddai-go/tx"
+	"fmt"
+)
+
+var _ UpdateScan = (*TableScan)(nil)
+
+// TableScan adds access by Constant to record.TableScan, so that it can be used as an UpdateScan.
+// Unlike record.TableScan, it checks that the fields exist and have the type of the accessed values.
+type TableScan struct {
+	*record.TableScan
+	schema *record.Schema
+}
+
+func NewTableScan(tx *tx.Transaction, tblname string, layout *record.Layout) (*TableScan, error) {
+	ts, err := record.NewTableScan(tx, tblname, layout)
+	if err != nil {
+		return nil, fmt.Errorf("record.NewTableScan: %w", err)
+	}
+	return &TableScan{TableScan: ts, schema: layout.Schema()}, nil
+}
+
+// checkField returns ErrFieldNotFound if the table has no such field, and ErrTypeMismatch if the field is not of the type.
+func (ts *TableScan) checkField(fldname string, typ record.FieldType) error {
+	if !ts.HasField(fldname) {
+		return fmt.Errorf("%s: %w", fldname, ErrFieldNotFound)
+	}
+	if ts.schema.Type(fldname) != typ {
+		return fmt.Errorf("%s: %w", fldname, ErrTypeMismatch)
+	}
+	return nil
+}
+
+func (ts *TableScan) GetInt(fldname string) (int32, error) {
+	if err := ts.checkField(fldname, record.Integer); err != nil {
+		return 0, err
+	}
+	return ts.TableScan.GetInt(fldname)
+}
+
+func (ts *TableScan) GetString(fldname string) (string, error) {
+	if err := ts.checkField(fldname, record.Varchar); err != nil {
+		return "", err
+	}
+	return ts.TableScan.GetString(fldname)
+}
+
+func (ts *TableScan) SetInt(fldname string, val int32) error {
+	if err := ts.checkField(fldname, record.Integer); err != nil {
+		return err
+	}
+	return ts.TableScan.SetInt(fldname, val)
+}
+
+func (ts *TableScan) SetString(fldname string, val string) error {
+	if err := ts.checkField(fldname, record.Varchar); err != nil {
+		return err
+	}
+	return ts.TableScan.SetString(fldname, val)
+}
+
+func (ts *TableScan) GetVal(fldname string) (Constant, error) {
+	if !ts.HasField(fldname) {
+		return Constant{}, fmt.Errorf("%s: %w", fldname, ErrFieldNotFound)
+	}
+	if ts.schema.Type(fldname) == record.Integer {
+		i, err := ts.TableScan.GetInt(fldname)
+		if err != nil {
+			return Constant{}, err
+		}
+		return NewIntConstant(i), nil
+	}
+	s, err := ts.TableScan.GetString(fldname)
+	if err != nil {
+		return Constant{}, err
+	}
+	return NewStringConstant(s), nil
+}
+
+// SetVal stores the value in the field, which must have the type of the value.
+// A string longer than the length of the field is rejected by record.TableScan.SetString.
+func (ts *TableScan) SetVal(fldname string, val Constant) error {
+	if !ts.HasField(fldname) {
+		return fmt.Errorf("%s: %w", fldname, ErrFieldNotFound)
+	}
+	if val.Type() != ts.schema.Type(fldname) {
+		return fmt.Errorf("%s = %v: %w", fldname, val, ErrTypeMismatch)
+	}
+	if ts.schema.Type(fldname) == record.Integer {
+		return ts.TableScan.SetInt(fldname, val.AsInt())
+	}
+	return ts.TableScan.SetString(fldname, val.AsString())
+}
+
+func (ts *TableScan) GetRID() (record.RID, error) {
+	return ts.TableScan.GetRID(), nil
+}
@@ -0,0 +1,62 @@
+package record
+
+import (
+	"ddai-go/file"
+	"errors"
+	"math"
+)
+
+// ErrSlotTooLarge is returned when a record slot does not fit in a block.
+var ErrSlotTooLarge = errors.New("record slot is larger than a block")
+
+// Layout describes the physical structure of a record slot:
+// the offset of each field, and the size of the slot including its empty/used flag.
+type Layout struct {
+	schema   *Schema
+	offsets  map[string]int32
+	slotSize int32
+}
+
+// NewLayout calculates the layout of a newly created table from its schema.
+// The offsets and the slot size saturate at math.MaxInt32, so that a slot too large for any block is detected as such.
+func NewLayout(schema *Schema) *Layout {
+	offsets := make(map[string]int32)
+	pos := int64(file.Int32ByteSize) // space for the empty/used flag
+	for _, fldname := range schema.Fields() {
+		offsets[fldname] = int32(min(pos, math.MaxInt32))
+		pos += lengthInBytes(schema, fldname)
+	}
+	return &Layout{
+		schema:   schema,
+		offsets:  offsets,
+		slotSize: int32(min(pos, math.MaxInt32)),
+	}
+}
+
+// NewLayoutWith - for restoring the layout of an existing table from the catalog
+func NewLayoutWith(schema *Schema, offsets map[string]int32, slotSize int32) *Layout {
+	return &Layout{
+		schema:   schema,
+		offsets:  offsets,
+		slotSize: slotSize,
+	}
+}
+
+func (l *Layout) Schema() *Schema {
+	return l.schema
+}
+
+func (l *Layout) Offset(fldname string) int32 {
+	return l.offsets[fldname]
+}
+
+func (l *Layout) SlotSize() int32 {
+	return l.slotSize
+}
+
+func lengthInBytes(schema *Schema, fldname string) int64 {
+	if schema.Type(fldname) == Integer {
+		return int64(file.Int32ByteSize)
+	}
+	return int64(file.Int32ByteSize) + int64(schema.Length(fldname))*int64(file.Utf16ByteSize)
+}
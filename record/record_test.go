@@ -0,0 +1,248 @@
+package record_test
+
+import (
+	"ddai-go/record"
+	"ddai-go/server"
+	"errors"
+	"path"
+	"testing"
+)
+
+func TestLayout(t *testing.T) {
+	t.Parallel()
+
+	sch := record.NewSchema()
+	sch.AddIntField("A")
+	sch.AddStringField("B", 9)
+	layout := record.NewLayout(sch)
+
+	wants := map[string]int32{"A": 4, "B": 8}
+	for fldname, want := range wants {
+		if got := layout.Offset(fldname); got != want {
+			t.Errorf("layout.Offset(%q)=%d, want %d", fldname, got, want)
+		}
+	}
+	if got := layout.SlotSize(); got != 30 {
+		t.Errorf("layout.SlotSize()=%d, want 30", got)
+	}
+}
+
+func TestRecordPage(t *testing.T) {
+	t.Parallel()
+
+	db, err := server.NewSimpleDB(path.Join(t.TempDir(), "recordtest"), 400, 8)
+	if err != nil {
+		t.Fatalf("server.NewSimpleDB: %v", err)
+	}
+	tx1 := db.NewTx()
+
+	sch := record.NewSchema()
+	sch.AddIntField("A")
+	sch.AddStringField("B", 9)
+	layout := record.NewLayout(sch)
+
+	blk, err := tx1.Append("recordpagetest")
+	if err != nil {
+		t.Fatalf("tx1.Append: %v", err)
+	}
+	rp, err := record.NewRecordPage(tx1, blk, layout)
+	if err != nil {
+		t.Fatalf("record.NewRecordPage: %v", err)
+	}
+	if err := rp.Format(); err != nil {
+		t.Fatalf("rp.Format: %v", err)
+	}
+
+	// fill the page: 400 / 30 = 13 slots
+	inserted := 0
+	slot, err := rp.InsertAfter(-1)
+	for ; slot >= 0; slot, err = rp.InsertAfter(slot) {
+		if err := rp.SetInt(slot, "A", slot); err != nil {
+			t.Fatalf("rp.SetInt: %v", err)
+		}
+		if err := rp.SetString(slot, "B", "rec"+string(rune('a'+slot))); err != nil {
+			t.Fatalf("rp.SetString: %v", err)
+		}
+		inserted++
+	}
+	if err != nil {
+		t.Fatalf("rp.InsertAfter: %v", err)
+	}
+	if inserted != 13 {
+		t.Fatalf("inserted %d records, want 13", inserted)
+	}
+
+	// delete records whose A is even
+	for slot, err = rp.NextAfter(-1); slot >= 0; slot, err = rp.NextAfter(slot) {
+		a, err := rp.GetInt(slot, "A")
+		if err != nil {
+			t.Fatalf("rp.GetInt: %v", err)
+		}
+		if a%2 == 0 {
+			if err := rp.Delete(slot); err != nil {
+				t.Fatalf("rp.Delete: %v", err)
+			}
+		}
+	}
+	if err != nil {
+		t.Fatalf("rp.NextAfter: %v", err)
+	}
+
+	remaining := 0
+	for slot, err = rp.NextAfter(-1); slot >= 0; slot, err = rp.NextAfter(slot) {
+		a, err := rp.GetInt(slot, "A")
+		if err != nil {
+			t.Fatalf("rp.GetInt: %v", err)
+		}
+		b, err := rp.GetString(slot, "B")
+		if err != nil {
+			t.Fatalf("rp.GetString: %v", err)
+		}
+		if a%2 == 0 || b != "rec"+string(rune('a'+a)) {
+			t.Errorf("slot %d: got {%d, %q}", slot, a, b)
+		}
+		remaining++
+	}
+	if remaining != 6 {
+		t.Errorf("%d records remain, want 6", remaining)
+	}
+
+	if err := tx1.Unpin(blk); err != nil {
+		t.Fatalf("tx1.Unpin: %v", err)
+	}
+	if err := tx1.Commit(); err != nil {
+		t.Fatalf("tx1.Commit: %v", err)
+	}
+}
+
+func TestTableScan(t *testing.T) {
+	t.Parallel()
+
+	db, err := server.NewSimpleDB(path.Join(t.TempDir(), "tablescantest"), 400, 8)
+	if err != nil {
+		t.Fatalf("server.NewSimpleDB: %v", err)
+	}
+	tx1 := db.NewTx()
+
+	sch := record.NewSchema()
+	sch.AddIntField("A")
+	sch.AddStringField("B", 9)
+	layout := record.NewLayout(sch)
+
+	ts, err := record.NewTableScan(tx1, "T", layout)
+	if err != nil {
+		t.Fatalf("record.NewTableScan: %v", err)
+	}
+	// 50 records span several blocks
+	for i := range int32(50) {
+		if err := ts.Insert(); err != nil {
+			t.Fatalf("ts.Insert: %v", err)
+		}
+		if err := ts.SetInt("A", i); err != nil {
+			t.Fatalf("ts.SetInt: %v", err)
+		}
+		if err := ts.SetString("B", "rec"+string(rune('0'+i%10))); err != nil {
+			t.Fatalf("ts.SetString: %v", err)
+		}
+	}
+
+	if err := ts.BeforeFirst(); err != nil {
+		t.Fatalf("ts.BeforeFirst: %v", err)
+	}
+	var deleted []record.RID
+	for {
+		ok, err := ts.Next()
+		if err != nil {
+			t.Fatalf("ts.Next: %v", err)
+		}
+		if !ok {
+			break
+		}
+		a, err := ts.GetInt("A")
+		if err != nil {
+			t.Fatalf("ts.GetInt: %v", err)
+		}
+		if a < 25 {
+			deleted = append(deleted, ts.GetRID())
+			if err := ts.Delete(); err != nil {
+				t.Fatalf("ts.Delete: %v", err)
+			}
+		}
+	}
+	if len(deleted) != 25 {
+		t.Fatalf("deleted %d records, want 25", len(deleted))
+	}
+
+	if err := ts.BeforeFirst(); err != nil {
+		t.Fatalf("ts.BeforeFirst: %v", err)
+	}
+	count := int32(0)
+	for {
+		ok, err := ts.Next()
+		if err != nil {
+			t.Fatalf("ts.Next: %v", err)
+		}
+		if !ok {
+			break
+		}
+		a, err := ts.GetInt("A")
+		if err != nil {
+			t.Fatalf("ts.GetInt: %v", err)
+		}
+		b, err := ts.GetString("B")
+		if err != nil {
+			t.Fatalf("ts.GetString: %v", err)
+		}
+		if a < 25 || b != "rec"+string(rune('0'+a%10)) {
+			t.Errorf("record %v: got {%d, %q}", ts.GetRID(), a, b)
+		}
+		count++
+	}
+	if count != 25 {
+		t.Errorf("%d records remain, want 25", count)
+	}
+
+	// moving to a record pins its block until the scan is closed
+	if err := ts.MoveToRID(deleted[0]); err != nil {
+		t.Fatalf("ts.MoveToRID: %v", err)
+	}
+	if err := ts.Close(); err != nil {
+		t.Fatalf("ts.Close: %v", err)
+	}
+	if err := tx1.Commit(); err != nil {
+		t.Fatalf("tx1.Commit: %v", err)
+	}
+	if n := db.BufferManager.NumAvailable(); n != 8 {
+		t.Errorf("bm.NumAvailable()=%d, want 8", n)
+	}
+}
+
+func TestTableScanSlotTooLarge(t *testing.T) {
+	t.Parallel()
+
+	db, err := server.NewSimpleDB(path.Join(t.TempDir(), "largeslottest"), 400, 8)
+	if err != nil {
+		t.Fatalf("server.NewSimpleDB: %v", err)
+	}
+	tx1 := db.NewTx()
+
+	sch := record.NewSchema()
+	sch.AddIntField("A")
+	sch.AddStringField("B", 500)
+	ts, err := record.NewTableScan(tx1, "T", record.NewLayout(sch))
+	if err != nil {
+		t.Fatalf("record.NewTableScan: %v", err)
+	}
+	if err := ts.Insert(); !errors.Is(err, record.ErrSlotTooLarge) {
+		t.Errorf("ts.Insert: got %v, want ErrSlotTooLarge", err)
+	}
+	if n, err := tx1.Size("T.tbl"); err != nil || n > 2 {
+		t.Errorf("tx1.Size()=%d, %v, want at most 2 blocks", n, err)
+	}
+	if err := ts.Close(); err != nil {
+		t.Fatalf("ts.Close: %v", err)
+	}
+	if err := tx1.Rollback(); err != nil {
+		t.Fatalf("tx1.Rollback: %v", err)
+	}
+}
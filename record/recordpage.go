@@ -0,0 +1,139 @@
+package record
+
+import (
+	"ddai-go/file"
+	"ddai-go/tx"
+	"errors"
+	"fmt"
+	"unicode/utf16"
+)
+
+// ErrValueTooLong is returned when a string does not fit in its field.
+var ErrValueTooLong = errors.New("value is too long for the field")
+
+// slot flags
+const (
+	empty int32 = iota
+	used
+)
+
+// RecordPage stores records in the slots of a block.
+// Each slot begins with a flag telling whether the slot is empty or used.
+type RecordPage struct {
+	tx     *tx.Transaction
+	blk    file.BlockID
+	layout *Layout
+}
+
+// NewRecordPage pins the block, and keeps it pinned until the transaction unpins it.
+func NewRecordPage(tx *tx.Transaction, blk file.BlockID, layout *Layout) (*RecordPage, error) {
+	if err := tx.Pin(blk); err != nil {
+		return nil, fmt.Errorf("tx.Pin: %w", err)
+	}
+	return &RecordPage{
+		tx:     tx,
+		blk:    blk,
+		layout: layout,
+	}, nil
+}
+
+func (rp *RecordPage) GetInt(slot int32, fldname string) (int32, error) {
+	return rp.tx.GetInt(rp.blk, rp.fieldPos(slot, fldname))
+}
+
+func (rp *RecordPage) GetString(slot int32, fldname string) (string, error) {
+	return rp.tx.GetString(rp.blk, rp.fieldPos(slot, fldname))
+}
+
+func (rp *RecordPage) SetInt(slot int32, fldname string, val int32) error {
+	return rp.tx.SetInt(rp.blk, rp.fieldPos(slot, fldname), val, true)
+}
+
+// SetString stores the string in the field, and returns ErrValueTooLong if it has more characters than the field.
+func (rp *RecordPage) SetString(slot int32, fldname string, val string) error {
+	if n, length := len(utf16.Encode([]rune(val))), rp.layout.Schema().Length(fldname); n > int(length) {
+		return fmt.Errorf("%w: %d characters in %s of length %d", ErrValueTooLong, n, fldname, length)
+	}
+	return rp.tx.SetString(rp.blk, rp.fieldPos(slot, fldname), val, true)
+}
+
+func (rp *RecordPage) Delete(slot int32) error {
+	return rp.setFlag(slot, empty)
+}
+
+// Format clears all slots of a new block.
+// These changes are not logged, because the old values of a new block are meaningless.
+func (rp *RecordPage) Format() error {
+	for slot := int32(0); rp.isValidSlot(slot); slot++ {
+		if err := rp.tx.SetInt(rp.blk, rp.offset(slot), empty, false); err != nil {
+			return fmt.Errorf("tx.SetInt: %w", err)
+		}
+		sch := rp.layout.Schema()
+		for _, fldname := range sch.Fields() {
+			pos := rp.fieldPos(slot, fldname)
+			var err error
+			if sch.Type(fldname) == Integer {
+				err = rp.tx.SetInt(rp.blk, pos, 0, false)
+			} else {
+				err = rp.tx.SetString(rp.blk, pos, "", false)
+			}
+			if err != nil {
+				return fmt.Errorf("format slot %d: %w", slot, err)
+			}
+		}
+	}
+	return nil
+}
+
+// NextAfter returns the first used slot after the specified slot, or -1 if there is none.
+func (rp *RecordPage) NextAfter(slot int32) (int32, error) {
+	return rp.searchAfter(slot, used)
+}
+
+// InsertAfter finds the first empty slot after the specified slot and marks it used.
+// It returns -1 if there is no empty slot.
+func (rp *RecordPage) InsertAfter(slot int32) (int32, error) {
+	newSlot, err := rp.searchAfter(slot, empty)
+	if err != nil {
+		return -1, err
+	}
+	if newSlot >= 0 {
+		if err := rp.setFlag(newSlot, used); err != nil {
+			return -1, err
+		}
+	}
+	return newSlot, nil
+}
+
+func (rp *RecordPage) Block() file.BlockID {
+	return rp.blk
+}
+
+func (rp *RecordPage) setFlag(slot int32, flag int32) error {
+	return rp.tx.SetInt(rp.blk, rp.offset(slot), flag, true)
+}
+
+func (rp *RecordPage) searchAfter(slot int32, flag int32) (int32, error) {
+	for slot++; rp.isValidSlot(slot); slot++ {
+		f, err := rp.tx.GetInt(rp.blk, rp.offset(slot))
+		if err != nil {
+			return -1, fmt.Errorf("tx.GetInt: %w", err)
+		}
+		if f == flag {
+			return slot, nil
+		}
+	}
+	return -1, nil
+}
+
+func (rp *RecordPage) isValidSlot(slot int32) bool {
+	return rp.offset(slot+1) <= rp.tx.BlockSize()
+}
+
+func (rp *RecordPage) offset(slot int32) int32 {
+	return slot * rp.layout.SlotSize()
+}
+
+func (rp *RecordPage) fieldPos(slot int32, fldname string) int32 {
+	return rp.offset(slot) + rp.layout.Offset(fldname)
+}
@@ -0,0 +1,17 @@
+package record
+
+import "fmt"
+
+// RID identifies a record by the block number within its file and the slot within the block.
+type RID struct {
+	BlockNum int32
+	Slot     int32
+}
+
+func NewRID(blockNum int32, slot int32) RID {
+	return RID{BlockNum: blockNum, Slot: slot}
+}
+
+func (r RID) String() string {
+	return fmt.Sprintf("[%d, %d]", r.BlockNum, r.Slot)
+}
@@ -0,0 +1,75 @@
+package record
+
+// FieldType is the type of a field, compatible with the constants of java.sql.Types
+type FieldType = int32
+
+const (
+	Integer FieldType = 4
+	Varchar FieldType = 12
+)
+
+type fieldInfo struct {
+	typ    FieldType
+	length int32
+}
+
+// Schema is the record schema of a table,
+// which contains the name and type of each field of the table, as well as the length of each varchar field.
+type Schema struct {
+	fields []string
+	info   map[string]fieldInfo
+}
+
+func NewSchema() *Schema {
+	return &Schema{
+		fields: make([]string, 0),
+		info:   make(map[string]fieldInfo),
+	}
+}
+
+// AddField adds a field to the schema.
+// length is meaningful only for varchar fields, and means the max number of characters.
+func (s *Schema) AddField(fldname string, typ FieldType, length int32) {
+	if _, ok := s.info[fldname]; !ok {
+		s.fields = append(s.fields, fldname)
+	}
+	s.info[fldname] = fieldInfo{typ: typ, length: length}
+}
+
+func (s *Schema) AddIntField(fldname string) {
+	s.AddField(fldname, Integer, 0)
+}
+
+func (s *Schema) AddStringField(fldname string, length int32) {
+	s.AddField(fldname, Varchar, length)
+}
+
+// Add adds a field to the schema having the same type and length as the field in another schema.
+func (s *Schema) Add(fldname string, sch *Schema) {
+	s.AddField(fldname, sch.Type(fldname), sch.Length(fldname))
+}
+
+// AddAll adds all fields of another schema.
+func (s *Schema) AddAll(sch *Schema) {
+	for _, fldname := range sch.Fields() {
+		s.Add(fldname, sch)
+	}
+}
+
+// Fields returns the field names in the order they were added.
+func (s *Schema) Fields() []string {
+	return s.fields
+}
+
+func (s *Schema) HasField(fldname string) bool {
+	_, ok := s.info[fldname]
+	return ok
+}
+
+func (s *Schema) Type(fldname string) FieldType {
+	return s.info[fldname].typ
+}
+
+func (s *Schema) Length(fldname string) int32 {
+	return s.info[fldname].length
+}
@@ -0,0 +1,196 @@
+package record
+
+import (
+	"ddai-go/file"
+	"ddai-go/tx"
+	"fmt"
+)
+
+// TableScan iterates over the records of a table, which are stored in the file "<tblname>.tbl".
+type TableScan struct {
+	tx          *tx.Transaction
+	layout      *Layout
+	rp          *RecordPage
+	filename    string
+	currentSlot int32
+}
+
+func NewTableScan(tx *tx.Transaction, tblname string, layout *Layout) (*TableScan, error) {
+	ts := &TableScan{
+		tx:       tx,
+		layout:   layout,
+		filename: tblname + ".tbl",
+	}
+	size, err := tx.Size(ts.filename)
+	if err != nil {
+		return nil, fmt.Errorf("tx.Size: %w", err)
+	}
+	if size == 0 {
+		err = ts.moveToNewBlock()
+	} else {
+		err = ts.moveToBlock(0)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ts, nil
+}
+
+// BeforeFirst positions the scan before the first record.
+func (ts *TableScan) BeforeFirst() error {
+	return ts.moveToBlock(0)
+}
+
+// Next moves to the next record, and returns false if there is no next record.
+func (ts *TableScan) Next() (bool, error) {
+	for {
+		slot, err := ts.rp.NextAfter(ts.currentSlot)
+		if err != nil {
+			return false, fmt.Errorf("rp.NextAfter: %w", err)
+		}
+		ts.currentSlot = slot
+		if slot >= 0 {
+			return true, nil
+		}
+		atLast, err := ts.atLastBlock()
+		if err != nil {
+			return false, err
+		}
+		if atLast {
+			return false, nil
+		}
+		if err := ts.moveToBlock(ts.rp.Block().Index + 1); err != nil {
+			return false, err
+		}
+	}
+}
+
+func (ts *TableScan) GetInt(fldname string) (int32, error) {
+	return ts.rp.GetInt(ts.currentSlot, fldname)
+}
+
+func (ts *TableScan) GetString(fldname string) (string, error) {
+	return ts.rp.GetString(ts.currentSlot, fldname)
+}
+
+func (ts *TableScan) HasField(fldname string) bool {
+	return ts.layout.Schema().HasField(fldname)
+}
+
+// Close unpins the current block.
+func (ts *TableScan) Close() error {
+	if ts.rp == nil {
+		return nil
+	}
+	blk := ts.rp.Block()
+	ts.rp = nil
+	if err := ts.tx.Unpin(blk); err != nil {
+		return fmt.Errorf("tx.Unpin: %w", err)
+	}
+	return nil
+}
+
+func (ts *TableScan) SetInt(fldname string, val int32) error {
+	return ts.rp.SetInt(ts.currentSlot, fldname, val)
+}
+
+func (ts *TableScan) SetString(fldname string, val string) error {
+	return ts.rp.SetString(ts.currentSlot, fldname, val)
+}
+
+// Insert finds an empty slot after the current record and moves to it,
+// appending a new block to the file if no empty slot remains.
+// It returns ErrSlotTooLarge if a new block has no slot.
+func (ts *TableScan) Insert() error {
+	appended := false
+	for {
+		slot, err := ts.rp.InsertAfter(ts.currentSlot)
+		if err != nil {
+			return fmt.Errorf("rp.InsertAfter: %w", err)
+		}
+		ts.currentSlot = slot
+		if slot >= 0 {
+			return nil
+		}
+		if appended {
+			return fmt.Errorf("%w: slot of %d bytes", ErrSlotTooLarge, ts.layout.SlotSize())
+		}
+		atLast, err := ts.atLastBlock()
+		if err != nil {
+			return err
+		}
+		if atLast {
+			err = ts.moveToNewBlock()
+			appended = true
+		} else {
+			err = ts.moveToBlock(ts.rp.Block().Index + 1)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (ts *TableScan) Delete() error {
+	return ts.rp.Delete(ts.currentSlot)
+}
+
+func (ts *TableScan) MoveToRID(rid RID) error {
+	if err := ts.Close(); err != nil {
+		return err
+	}
+	blk := file.NewBlockID(ts.filename, rid.BlockNum)
+	rp, err := NewRecordPage(ts.tx, blk, ts.layout)
+	if err != nil {
+		return fmt.Errorf("NewRecordPage: %w", err)
+	}
+	ts.rp = rp
+	ts.currentSlot = rid.Slot
+	return nil
+}
+
+func (ts *TableScan) GetRID() RID {
+	return NewRID(ts.rp.Block().Index, ts.currentSlot)
+}
+
+func (ts *TableScan) moveToBlock(blkNum int32) error {
+	if err := ts.Close(); err != nil {
+		return err
+	}
+	blk := file.NewBlockID(ts.filename, blkNum)
+	rp, err := NewRecordPage(ts.tx, blk, ts.layout)
+	if err != nil {
+		return fmt.Errorf("NewRecordPage: %w", err)
+	}
+	ts.rp = rp
+	ts.currentSlot = -1
+	return nil
+}
+
+func (ts *TableScan) moveToNewBlock() error {
+	if err := ts.Close(); err != nil {
+		return err
+	}
+	blk, err := ts.tx.Append(ts.filename)
+	if err != nil {
+		return fmt.Errorf("tx.Append: %w", err)
+	}
+	rp, err := NewRecordPage(ts.tx, blk, ts.layout)
+	if err != nil {
+		return fmt.Errorf("NewRecordPage: %w", err)
+	}
+	ts.rp = rp
+	if err := ts.rp.Format(); err != nil {
+		return fmt.Errorf("rp.Format: %w", err)
+	}
+	ts.currentSlot = -1
+	return nil
+}
+
+func (ts *TableScan) atLastBlock() (bool, error) {
+	size, err := ts.tx.Size(ts.filename)
+	if err != nil {
+		return false, fmt.Errorf("tx.Size: %w", err)
+	}
+	return ts.rp.Block().Index == size-1, nil
+}
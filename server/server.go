@@ -4,19 +4,54 @@ import (
 	"ddai-go/buffer"
 	"ddai-go/file"
 	"ddai-go/log"
+	"ddai-go/metadata"
+	"ddai-go/plan"
+	"ddai-go/tx"
 	"fmt"
 )
 
 type SimpleDB struct {
-	FileManager   *file.Manager
-	LogManager    *log.Manager
-	BufferManager *buffer.Manager
+	FileManager     *file.Manager
+	LogManager      *log.Manager
+	BufferManager   *buffer.Manager
+	TxManager       *tx.Manager
+	MetadataManager *metadata.MetadataMgr
+	Planner         *plan.Planner
 }
 
 const logFile = "simpledb.log"
 
-func NewSimpleDB(dbDir string, blockSize int32, buffSize int32) (*SimpleDB, error) {
-	fileManager, err := file.NewManager(dbDir, blockSize)
+type config struct {
+	fileOpts   []file.Option
+	bufferOpts []buffer.Option
+}
+
+// Option configures a SimpleDB.
+type Option func(*config)
+
+// WithFileOptions passes the options to the file manager, e.g. to choose its durability.
+func WithFileOptions(opts ...file.Option) Option {
+	return func(c *config) {
+		c.fileOpts = append(c.fileOpts, opts...)
+	}
+}
+
+// WithBufferOptions passes the options to the buffer manager, e.g. to choose its replacement policy.
+func WithBufferOptions(opts ...buffer.Option) Option {
+	return func(c *config) {
+		c.bufferOpts = append(c.bufferOpts, opts...)
+	}
+}
+
+// NewSimpleDB creates the file, log and buffer managers only.
+// It is useful for testing the lower layers, which must not see the records of the metadata catalog.
+func NewSimpleDB(dbDir string, blockSize int32, buffSize int32, opts ...Option) (*SimpleDB, error) {
+	var cfg config
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	fileManager, err := file.NewManager(dbDir, blockSize, cfg.fileOpts...)
 	if err != nil {
 		return nil, fmt.Errorf("file.NewManager: %w", err)
 	}
@@ -26,7 +61,63 @@ func NewSimpleDB(dbDir string, blockSize int32, buffSize int32) (*SimpleDB, erro
 		return nil, fmt.Errorf("log.NewManager: %w", err)
 	}
 
-	bufferManager := buffer.NewManager(fileManager, buffSize)
+	bufferManager := buffer.NewManager(fileManager, logManager, buffSize, cfg.bufferOpts...)
+
+	txManager, err := tx.NewManager(fileManager, logManager, bufferManager)
+	if err != nil {
+		return nil, fmt.Errorf("tx.NewManager: %w", err)
+	}
+
+	return &SimpleDB{
+		FileManager:   fileManager,
+		LogManager:    logManager,
+		BufferManager: bufferManager,
+		TxManager:     txManager,
+	}, nil
+}
 
-	return &SimpleDB{fileManager, logManager, bufferManager}, nil
+// NewSimpleDBWithMetadata creates a database with its metadata catalog and planner.
+// If the database is new, the catalog tables are created, otherwise the database is recovered.
+func NewSimpleDBWithMetadata(dbDir string, blockSize int32, buffSize int32, opts ...Option) (*SimpleDB, error) {
+	db, err := NewSimpleDB(dbDir, blockSize, buffSize, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	tx := db.NewTx()
+	isNew := db.FileManager.IsNew
+	if !isNew {
+		if err := tx.Recover(); err != nil {
+			return nil, fmt.Errorf("tx.Recover: %w", err)
+		}
+	}
+	db.MetadataManager, err = metadata.NewMetadataMgr(isNew, tx)
+	if err != nil {
+		return nil, fmt.Errorf("metadata.NewMetadataMgr: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("tx.Commit: %w", err)
+	}
+
+	db.Planner = plan.NewPlanner(
+		plan.NewHeuristicQueryPlanner(db.MetadataManager),
+		plan.NewBasicUpdatePlanner(db.MetadataManager),
+	)
+
+	return db, nil
+}
+
+func (db *SimpleDB) NewTx() *tx.Transaction {
+	return db.TxManager.New()
+}
+
+// Close stops the background work of the database, and closes its files.
+func (db *SimpleDB) Close() error {
+	if err := db.BufferManager.Close(); err != nil {
+		return fmt.Errorf("buffer.Close: %w", err)
+	}
+	if err := db.FileManager.Close(); err != nil {
+		return fmt.Errorf("file.Close: %w", err)
+	}
+	return nil
 }
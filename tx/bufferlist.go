@@ -1,27 +1,39 @@
 package tx
 
 import (
+	"context"
 	"ddai-go/buffer"
 	"ddai-go/file"
-	"log"
+	"fmt"
+	"slices"
 )
 
 type BufferList struct {
 	buffers map[file.BlockID]*buffer.Buffer
 	pins    []file.BlockID
 	bm      *buffer.Manager
+	txNum   int32
 }
 
-func newBufferList(bm *buffer.Manager) *BufferList {
+func newBufferList(bm *buffer.Manager, txNum int32) *BufferList {
 	return &BufferList{
 		buffers: make(map[file.BlockID]*buffer.Buffer),
 		pins:    make([]file.BlockID, 0),
 		bm:      bm,
+		txNum:   txNum,
 	}
 }
 
+func (b *BufferList) getBuffer(blk file.BlockID) (*buffer.Buffer, error) {
+	buf, ok := b.buffers[blk]
+	if !ok {
+		return nil, fmt.Errorf("%v: %w", blk, buffer.ErrNotPinned)
+	}
+	return buf, nil
+}
+
 func (b *BufferList) pin(blk file.BlockID) error {
-	buf, err := b.bm.Pin(blk)
+	buf, err := b.bm.PinFor(context.Background(), b.txNum, blk)
 	if err != nil {
 		return err
 	}
@@ -30,29 +42,30 @@ func (b *BufferList) pin(blk file.BlockID) error {
 	return nil
 }
 
-func (b *BufferList) unpin(blk file.BlockID) {
-	buf, ok := b.buffers[blk]
-	if !ok {
-		log.Panicf("buffer not found %v", blk)
+// unpin releases one pin of the block, and returns buffer.ErrNotPinned if the block is not pinned.
+// The block may have been pinned several times, so the buffer is forgotten only when its last pin is released.
+func (b *BufferList) unpin(blk file.BlockID) error {
+	buf, err := b.getBuffer(blk)
+	if err != nil {
+		return err
+	}
+	if err := b.bm.UnpinFor(b.txNum, buf); err != nil {
+		return fmt.Errorf("bm.UnpinFor: %w", err)
 	}
-	// unpin the buffer
-	b.bm.Unpin(buf)
-	// remove from buffers
-	delete(b.buffers, blk)
-	// remove from pins
-	var newPins = make([]file.BlockID, 0, len(b.pins))
-	for _, p := range b.pins {
-		if p != blk {
-			newPins = append(newPins, p)
-		}
+	// remove one occurrence from pins
+	if i := slices.Index(b.pins, blk); i >= 0 {
+		b.pins = slices.Delete(b.pins, i, i+1)
 	}
-	b.pins = newPins
+	// remove from buffers if no pin remains
+	if !slices.Contains(b.pins, blk) {
+		delete(b.buffers, blk)
+	}
+	return nil
 }
 
+// unpinAll releases the pins left at the end of the transaction, which the buffer manager reports as leaked.
 func (b *BufferList) unpinAll() {
-	for _, blk := range b.pins {
-		b.unpin(blk)
-	}
+	b.bm.ReleasePins(b.txNum)
 	b.buffers = make(map[file.BlockID]*buffer.Buffer)
 	b.pins = make([]file.BlockID, 0)
 }
@@ -5,22 +5,24 @@ import (
 	"fmt"
 )
 
-var lockTable = newLockTable()
-
+// Manager holds the locks of a transaction.
+// The lock table is shared by all transactions of a database.
 type Manager struct {
-	locks map[file.BlockID]string
+	lockTable *LockTable
+	locks     map[file.BlockID]string
 }
 
-func New() *Manager {
+func New(lockTable *LockTable) *Manager {
 	return &Manager{
-		locks: make(map[file.BlockID]string),
+		lockTable: lockTable,
+		locks:     make(map[file.BlockID]string),
 	}
 }
 func (m *Manager) SLock(blk file.BlockID) error {
 	if m.locks[blk] != "" {
 		return nil
 	}
-	if err := lockTable.SLock(blk); err != nil {
+	if err := m.lockTable.SLock(blk); err != nil {
 		return fmt.Errorf("shared lock failed %v: %w", blk, err)
 	}
 	m.locks[blk] = "S"
@@ -31,10 +33,10 @@ func (m *Manager) XLock(blk file.BlockID) error {
 	if m.HasXLock(blk) {
 		return nil
 	}
-	if err := lockTable.SLock(blk); err != nil {
-		return fmt.Errorf("shared lock failed %v: %w", blk, err)
+	if err := m.SLock(blk); err != nil {
+		return err
 	}
-	if err := lockTable.XLock(blk); err != nil {
+	if err := m.lockTable.XLock(blk); err != nil {
 		return fmt.Errorf("exclusive lock failed %v: %w", blk, err)
 	}
 
@@ -44,7 +46,7 @@ func (m *Manager) XLock(blk file.BlockID) error {
 
 func (m *Manager) Release() {
 	for blk := range m.locks {
-		lockTable.Unlock(blk)
+		m.lockTable.Unlock(blk)
 	}
 	clear(m.locks)
 }
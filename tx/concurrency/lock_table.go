@@ -16,7 +16,7 @@ type LockTable struct {
 	cond  *sync.Cond
 }
 
-func newLockTable() *LockTable {
+func NewLockTable() *LockTable {
 	return &LockTable{
 		locks: make(map[file.BlockID]int),
 		cond:  sync.NewCond(&sync.Mutex{}),
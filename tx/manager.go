@@ -0,0 +1,43 @@
+package tx
+
+import (
+	"ddai-go/buffer"
+	"ddai-go/file"
+	"ddai-go/log"
+	"ddai-go/tx/concurrency"
+	"ddai-go/tx/recovery"
+	"fmt"
+	"sync/atomic"
+)
+
+// Manager creates the transactions of a database.
+// It hands out transaction numbers and holds the lock table shared by its transactions.
+type Manager struct {
+	fileMgr   *file.Manager
+	logMgr    *log.Manager
+	bufferMgr *buffer.Manager
+	lockTable *concurrency.LockTable
+	lastTxNum atomic.Int32
+}
+
+// NewManager continues the transaction numbers from the largest one found in the log,
+// so that numbers are never reused across restarts.
+func NewManager(fileMgr *file.Manager, logMgr *log.Manager, bufferMgr *buffer.Manager) (*Manager, error) {
+	lastTxNum, err := recovery.LastTxNum(logMgr)
+	if err != nil {
+		return nil, fmt.Errorf("recovery.LastTxNum: %w", err)
+	}
+	m := &Manager{
+		fileMgr:   fileMgr,
+		logMgr:    logMgr,
+		bufferMgr: bufferMgr,
+		lockTable: concurrency.NewLockTable(),
+	}
+	m.lastTxNum.Store(lastTxNum)
+	return m, nil
+}
+
+// New starts a new transaction.
+func (m *Manager) New() *Transaction {
+	return newTransaction(m, m.lastTxNum.Add(1))
+}
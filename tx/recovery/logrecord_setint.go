@@ -61,7 +61,9 @@ func (r setIntRecord) Undo(transactor Transactor) error {
 	if err := transactor.SetInt(r.blk, r.offset, r.val, false); err != nil {
 		return fmt.Errorf("cannot set block %v: %v", r.blk, err)
 	}
-	transactor.Unpin(r.blk)
+	if err := transactor.Unpin(r.blk); err != nil {
+		return fmt.Errorf("cannot unpin block %v: %v", r.blk, err)
+	}
 	return nil
 }
 
@@ -55,10 +55,15 @@ func (r setStringRecord) TxNumber() int32 {
 }
 
 func (r setStringRecord) Undo(transactor Transactor) error {
-	err := transactor.Pin(r.blk)
-	if err != nil {
+	if err := transactor.Pin(r.blk); err != nil {
 		return fmt.Errorf("cannot pin block %v: %v", r.blk, err)
 	}
+	if err := transactor.SetString(r.blk, r.offset, r.val, false); err != nil {
+		return fmt.Errorf("cannot set block %v: %v", r.blk, err)
+	}
+	if err := transactor.Unpin(r.blk); err != nil {
+		return fmt.Errorf("cannot unpin block %v: %v", r.blk, err)
+	}
 	return nil
 }
 
@@ -72,11 +77,11 @@ func (r setStringRecord) WriteToLog(lm *log.Manager) (int32, error) {
 	blkOffset := fileOffset + file.MaxLength(len(r.blk.FileName))
 	oOffset := blkOffset + file.Int32ByteSize
 	valOffset := oOffset + file.Int32ByteSize
-	recLen := valOffset + file.Int32ByteSize
+	recLen := valOffset + file.MaxLength(len(r.val))
 
 	buf := make([]byte, recLen)
 	p := file.NewPageWith(buf)
-	p.SetInt(0, SetInt)
+	p.SetInt(0, SetString)
 	p.SetInt(txOffset, r.txNum)
 	p.SetString(fileOffset, r.blk.FileName)
 	p.SetInt(blkOffset, r.blk.Index)
@@ -3,6 +3,7 @@ package recovery
 import (
 	"ddai-go/file"
 	"ddai-go/log"
+	"fmt"
 )
 
 var _ LogRecord = (*startRecord)(nil)
@@ -34,7 +35,7 @@ func (s startRecord) Undo(transactor Transactor) error {
 }
 
 func (s startRecord) String() string {
-	return "<START " + string(s.txNum) + ">"
+	return fmt.Sprintf("<START %d>", s.txNum)
 }
 
 func (s startRecord) WriteToLog(lm *log.Manager) (int32, error) {
@@ -13,7 +13,7 @@ type Transactor interface {
 	Pin(blk file.BlockID) error
 	SetString(blk file.BlockID, offset int32, val string, logRecord bool) error
 	SetInt(blk file.BlockID, offset int32, val int32, logRecord bool) error
-	Unpin(blk file.BlockID)
+	Unpin(blk file.BlockID) error
 }
 
 type Manager struct {
@@ -86,12 +86,16 @@ func (m *Manager) Recover() error {
 	return nil
 }
 
+// SetInt writes a log record holding the old value at the offset of the buffer, and returns its LSN.
+// The caller must hold the latch of the buffer.
 func (m *Manager) SetInt(buf *buffer.Buffer, offset int32, newVal int32) (int32, error) {
 	oldVal := buf.Contents.GetInt(offset)
 	blk := buf.Block
 	return newSetIntRecord(m.txNum, blk, offset, oldVal).WriteToLog(m.logMgr)
 }
 
+// SetString writes a log record holding the old value at the offset of the buffer, and returns its LSN.
+// The caller must hold the latch of the buffer.
 func (m *Manager) SetString(buf *buffer.Buffer, offset int32, newVal string) (int32, error) {
 	oldVal := buf.Contents.GetString(offset)
 	blk := buf.Block
@@ -151,3 +155,33 @@ func (m *Manager) doRecover() error {
 	}
 	return nil
 }
+
+// LastTxNum returns the largest transaction number found in the log, or 0 if the log has no transaction.
+// The log is read backwards until the start record preceding the latest checkpoint:
+// a checkpoint is written while no other transaction is running,
+// so no transaction older than the one writing it can have a larger number.
+func LastTxNum(lm *log.Manager) (int32, error) {
+	it, err := lm.Iterator()
+	if err != nil {
+		return 0, fmt.Errorf("lm.Iterator: %w", err)
+	}
+	lastTxNum := int32(0)
+	passedCheckPoint := false
+	for it.HasNext() {
+		bytes, err := it.Next()
+		if err != nil {
+			return 0, fmt.Errorf("it.Next: %w", err)
+		}
+		rec, err := NewLogRecord(bytes)
+		if err != nil {
+			return 0, fmt.Errorf("NewLogRecord: %w", err)
+		}
+		lastTxNum = max(lastTxNum, rec.TxNumber())
+		if rec.Op() == CheckPoint {
+			passedCheckPoint = true
+		} else if passedCheckPoint && rec.Op() == Start {
+			break
+		}
+	}
+	return lastTxNum, nil
+}
@@ -3,11 +3,9 @@ package tx
 import (
 	"ddai-go/buffer"
 	"ddai-go/file"
-	"ddai-go/log"
 	"ddai-go/tx/concurrency"
 	"ddai-go/tx/recovery"
 	"fmt"
-	"sync/atomic"
 )
 
 type Transaction struct {
@@ -19,24 +17,20 @@ type Transaction struct {
 	bufs        *BufferList
 }
 
-func New(fileMgr *file.Manager, logMgr *log.Manager, bufManager *buffer.Manager) *Transaction {
-	txNum := nextTxNum()
+func newTransaction(m *Manager, txNum int32) *Transaction {
 	tx := &Transaction{
-		concurMgr: concurrency.New(),
-		bufferMgr: bufManager,
-		fileMgr:   fileMgr,
+		concurMgr: concurrency.New(m.lockTable),
+		bufferMgr: m.bufferMgr,
+		fileMgr:   m.fileMgr,
 		txNum:     txNum,
-		bufs:      newBufferList(bufManager),
+		bufs:      newBufferList(m.bufferMgr, txNum),
 	}
-	tx.recoveryMgr = recovery.New(logMgr, bufManager, tx, txNum)
+	tx.recoveryMgr = recovery.New(m.logMgr, m.bufferMgr, tx, txNum)
 	return tx
 }
 
-var txNum = int32(0)
-
-func nextTxNum() int32 {
-	atomic.AddInt32(&txNum, 1)
-	return txNum
+func (tx *Transaction) TxNum() int32 {
+	return tx.txNum
 }
 
 func (tx *Transaction) Commit() error {
@@ -73,25 +67,123 @@ func (tx *Transaction) Pin(blk file.BlockID) error {
 	return tx.bufs.pin(blk)
 }
 
-func (tx *Transaction) Unpin(blk file.BlockID) {
-	tx.bufs.unpin(blk)
+// Unpin releases a pin of the block, and returns buffer.ErrNotPinned if the transaction does not hold it.
+func (tx *Transaction) Unpin(blk file.BlockID) error {
+	return tx.bufs.unpin(blk)
 }
 
-func (tx *Transaction) GetInt(blk file.BlockID, offset int32) int {
-	// TODO
-	return 0
+// GetInt returns the int32 stored at the offset of the pinned block,
+// after acquiring a shared lock on it.
+func (tx *Transaction) GetInt(blk file.BlockID, offset int32) (int32, error) {
+	if err := tx.concurMgr.SLock(blk); err != nil {
+		return 0, fmt.Errorf("concurMgr.SLock: %w", err)
+	}
+	buf, err := tx.bufs.getBuffer(blk)
+	if err != nil {
+		return 0, fmt.Errorf("bufs.getBuffer: %w", err)
+	}
+	buf.RLock()
+	defer buf.RUnlock()
+	return buf.Contents.GetInt(offset), nil
 }
+
+// SetInt stores an int32 at the offset of the pinned block, after acquiring an exclusive lock on it.
+// If okToLog is true, the old value is written to the log so that the change can be undone.
 func (tx *Transaction) SetInt(blk file.BlockID, offset int32, value int32, okToLog bool) error {
-	// TODO
+	if err := tx.concurMgr.XLock(blk); err != nil {
+		return fmt.Errorf("concurMgr.XLock: %w", err)
+	}
+	buf, err := tx.bufs.getBuffer(blk)
+	if err != nil {
+		return fmt.Errorf("bufs.getBuffer: %w", err)
+	}
+	buf.Lock()
+	defer buf.Unlock()
+	lsn := int32(-1)
+	if okToLog {
+		lsn, err = tx.recoveryMgr.SetInt(buf, offset, value)
+		if err != nil {
+			return fmt.Errorf("recoveryMgr.SetInt: %w", err)
+		}
+	}
+	buf.Contents.SetInt(offset, value)
+	buf.SetModified(tx.txNum, lsn)
 	return nil
 }
 
-func (tx *Transaction) GetString(blk file.BlockID, offset int32) string {
-	// TODO
-	return ""
+// GetString returns the string stored at the offset of the pinned block,
+// after acquiring a shared lock on it.
+func (tx *Transaction) GetString(blk file.BlockID, offset int32) (string, error) {
+	if err := tx.concurMgr.SLock(blk); err != nil {
+		return "", fmt.Errorf("concurMgr.SLock: %w", err)
+	}
+	buf, err := tx.bufs.getBuffer(blk)
+	if err != nil {
+		return "", fmt.Errorf("bufs.getBuffer: %w", err)
+	}
+	buf.RLock()
+	defer buf.RUnlock()
+	return buf.Contents.GetString(offset), nil
 }
 
+// SetString stores a string at the offset of the pinned block, after acquiring an exclusive lock on it.
+// If okToLog is true, the old value is written to the log so that the change can be undone.
 func (tx *Transaction) SetString(blk file.BlockID, offset int32, value string, okToLog bool) error {
-	// TODO
+	if err := tx.concurMgr.XLock(blk); err != nil {
+		return fmt.Errorf("concurMgr.XLock: %w", err)
+	}
+	buf, err := tx.bufs.getBuffer(blk)
+	if err != nil {
+		return fmt.Errorf("bufs.getBuffer: %w", err)
+	}
+	buf.Lock()
+	defer buf.Unlock()
+	lsn := int32(-1)
+	if okToLog {
+		lsn, err = tx.recoveryMgr.SetString(buf, offset, value)
+		if err != nil {
+			return fmt.Errorf("recoveryMgr.SetString: %w", err)
+		}
+	}
+	buf.Contents.SetString(offset, value)
+	buf.SetModified(tx.txNum, lsn)
 	return nil
 }
+
+// endOfFile is the block index of the dummy block that represents the end of a file.
+// Locking it prevents other transactions from appending blocks while the file size is read (phantoms).
+const endOfFile = int32(-1)
+
+// Size returns the number of blocks in the file, after acquiring a shared lock on its end.
+func (tx *Transaction) Size(filename string) (int32, error) {
+	dummy := file.NewBlockID(filename, endOfFile)
+	if err := tx.concurMgr.SLock(dummy); err != nil {
+		return 0, fmt.Errorf("concurMgr.SLock: %w", err)
+	}
+	size, err := tx.fileMgr.Length(filename)
+	if err != nil {
+		return 0, fmt.Errorf("fileMgr.Length: %w", err)
+	}
+	return size, nil
+}
+
+// Append adds a new block to the end of the file, after acquiring an exclusive lock on its end.
+func (tx *Transaction) Append(filename string) (file.BlockID, error) {
+	dummy := file.NewBlockID(filename, endOfFile)
+	if err := tx.concurMgr.XLock(dummy); err != nil {
+		return file.BlockID{}, fmt.Errorf("concurMgr.XLock: %w", err)
+	}
+	blk, err := tx.fileMgr.Extend(filename)
+	if err != nil {
+		return file.BlockID{}, fmt.Errorf("fileMgr.Extend: %w", err)
+	}
+	return blk, nil
+}
+
+func (tx *Transaction) BlockSize() int32 {
+	return tx.fileMgr.BlockSize
+}
+
+func (tx *Transaction) AvailableBuffs() int32 {
+	return tx.bufferMgr.NumAvailable()
+}
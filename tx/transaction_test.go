@@ -0,0 +1,374 @@
+package tx_test
+
+import (
+	"ddai-go/buffer"
+	"ddai-go/file"
+	"ddai-go/server"
+	"ddai-go/tx"
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"testing"
+)
+
+func TestTransaction(t *testing.T) {
+	t.Parallel()
+
+	db, err := server.NewSimpleDB(path.Join(t.TempDir(), "txtest"), 400, 8)
+	if err != nil {
+		t.Fatalf("server.NewSimpleDB: %v", err)
+	}
+	bm := db.BufferManager
+
+	blk := file.NewBlockID("testfile", 1)
+
+	// initial values are not logged
+	tx1 := db.NewTx()
+	if err := tx1.Pin(blk); err != nil {
+		t.Fatalf("tx1.Pin: %v", err)
+	}
+	if err := tx1.SetInt(blk, 80, 1, false); err != nil {
+		t.Fatalf("tx1.SetInt: %v", err)
+	}
+	if err := tx1.SetString(blk, 40, "one", false); err != nil {
+		t.Fatalf("tx1.SetString: %v", err)
+	}
+	if err := tx1.Commit(); err != nil {
+		t.Fatalf("tx1.Commit: %v", err)
+	}
+
+	tx2 := db.NewTx()
+	if err := tx2.Pin(blk); err != nil {
+		t.Fatalf("tx2.Pin: %v", err)
+	}
+	ival, err := tx2.GetInt(blk, 80)
+	if err != nil {
+		t.Fatalf("tx2.GetInt: %v", err)
+	}
+	sval, err := tx2.GetString(blk, 40)
+	if err != nil {
+		t.Fatalf("tx2.GetString: %v", err)
+	}
+	if ival != 1 || sval != "one" {
+		t.Fatalf("tx2 read (%d, %q), want (1, \"one\")", ival, sval)
+	}
+	if err := tx2.SetInt(blk, 80, ival+1, true); err != nil {
+		t.Fatalf("tx2.SetInt: %v", err)
+	}
+	if err := tx2.SetString(blk, 40, sval+"!", true); err != nil {
+		t.Fatalf("tx2.SetString: %v", err)
+	}
+	if err := tx2.Commit(); err != nil {
+		t.Fatalf("tx2.Commit: %v", err)
+	}
+
+	// modifications of tx3 are undone by the rollback
+	tx3 := db.NewTx()
+	if err := tx3.Pin(blk); err != nil {
+		t.Fatalf("tx3.Pin: %v", err)
+	}
+	if err := tx3.SetInt(blk, 80, 9999, true); err != nil {
+		t.Fatalf("tx3.SetInt: %v", err)
+	}
+	if err := tx3.SetString(blk, 40, "nine", true); err != nil {
+		t.Fatalf("tx3.SetString: %v", err)
+	}
+	ival, err = tx3.GetInt(blk, 80)
+	if err != nil {
+		t.Fatalf("tx3.GetInt: %v", err)
+	}
+	if ival != 9999 {
+		t.Fatalf("tx3.GetInt=%d, want 9999", ival)
+	}
+	if err := tx3.Rollback(); err != nil {
+		t.Fatalf("tx3.Rollback: %v", err)
+	}
+
+	tx4 := db.NewTx()
+	if err := tx4.Pin(blk); err != nil {
+		t.Fatalf("tx4.Pin: %v", err)
+	}
+	ival, err = tx4.GetInt(blk, 80)
+	if err != nil {
+		t.Fatalf("tx4.GetInt: %v", err)
+	}
+	sval, err = tx4.GetString(blk, 40)
+	if err != nil {
+		t.Fatalf("tx4.GetString: %v", err)
+	}
+	if ival != 2 || sval != "one!" {
+		t.Errorf("tx4 read (%d, %q), want (2, \"one!\")", ival, sval)
+	}
+	if err := tx4.Commit(); err != nil {
+		t.Fatalf("tx4.Commit: %v", err)
+	}
+
+	if n := bm.NumAvailable(); n != 8 {
+		t.Errorf("bm.NumAvailable()=%d, want 8", n)
+	}
+}
+
+func TestTransactionSizeAndAppend(t *testing.T) {
+	t.Parallel()
+
+	db, err := server.NewSimpleDB(path.Join(t.TempDir(), "txsizetest"), 400, 8)
+	if err != nil {
+		t.Fatalf("server.NewSimpleDB: %v", err)
+	}
+
+	tx1 := db.NewTx()
+	if got := tx1.BlockSize(); got != 400 {
+		t.Errorf("tx1.BlockSize()=%d, want 400", got)
+	}
+	if got := tx1.AvailableBuffs(); got != 8 {
+		t.Errorf("tx1.AvailableBuffs()=%d, want 8", got)
+	}
+
+	for i := range int32(3) {
+		blk, err := tx1.Append("sizefile")
+		if err != nil {
+			t.Fatalf("tx1.Append: %v", err)
+		}
+		if blk.Index != i {
+			t.Errorf("appended block %d, want %d", blk.Index, i)
+		}
+	}
+	size, err := tx1.Size("sizefile")
+	if err != nil {
+		t.Fatalf("tx1.Size: %v", err)
+	}
+	if size != 3 {
+		t.Errorf("tx1.Size()=%d, want 3", size)
+	}
+	if err := tx1.Commit(); err != nil {
+		t.Fatalf("tx1.Commit: %v", err)
+	}
+}
+
+func TestManagerTxNumAfterRestart(t *testing.T) {
+	t.Parallel()
+
+	dbDir := path.Join(t.TempDir(), "txnumtest")
+	lastTxNum := int32(0)
+	for range 3 {
+		db, err := server.NewSimpleDBWithMetadata(dbDir, 400, 8)
+		if err != nil {
+			t.Fatalf("server.NewSimpleDBWithMetadata: %v", err)
+		}
+		for range 2 {
+			tx1 := db.NewTx()
+			if tx1.TxNum() <= lastTxNum {
+				t.Errorf("tx number %d is not greater than the last one %d", tx1.TxNum(), lastTxNum)
+			}
+			lastTxNum = tx1.TxNum()
+			if err := tx1.Commit(); err != nil {
+				t.Fatalf("tx1.Commit: %v", err)
+			}
+		}
+	}
+
+	// without recovery, the log has no checkpoint
+	db, err := server.NewSimpleDB(dbDir, 400, 8)
+	if err != nil {
+		t.Fatalf("server.NewSimpleDB: %v", err)
+	}
+	if got := db.NewTx().TxNum(); got != lastTxNum+1 {
+		t.Errorf("tx number=%d, want %d", got, lastTxNum+1)
+	}
+}
+
+func TestManagerIndependentDatabases(t *testing.T) {
+	t.Parallel()
+
+	var txs []*tx.Transaction
+	for _, name := range []string{"db1", "db2"} {
+		db, err := server.NewSimpleDB(path.Join(t.TempDir(), name), 400, 8)
+		if err != nil {
+			t.Fatalf("server.NewSimpleDB: %v", err)
+		}
+		txs = append(txs, db.NewTx())
+	}
+	if txs[0].TxNum() != txs[1].TxNum() {
+		t.Errorf("tx numbers of new databases differ: %d, %d", txs[0].TxNum(), txs[1].TxNum())
+	}
+
+	// the same block name in different databases does not conflict
+	blk := file.NewBlockID("testfile", 0)
+	for _, tx := range txs {
+		if err := tx.Pin(blk); err != nil {
+			t.Fatalf("tx.Pin: %v", err)
+		}
+		if err := tx.SetInt(blk, 0, 1, true); err != nil {
+			t.Fatalf("tx.SetInt: %v", err)
+		}
+	}
+	for _, tx := range txs {
+		if err := tx.Commit(); err != nil {
+			t.Fatalf("tx.Commit: %v", err)
+		}
+	}
+}
+
+func TestTransactionPins(t *testing.T) {
+	t.Parallel()
+
+	var leaks []file.BlockID
+	db, err := server.NewSimpleDB(path.Join(t.TempDir(), "pintest"), 400, 8,
+		server.WithBufferOptions(
+			buffer.WithMaxPinsPerTx(2),
+			buffer.WithPinLeakHandler(func(txNum int32, blocks []file.BlockID) {
+				leaks = append(leaks, blocks...)
+			}),
+		))
+	if err != nil {
+		t.Fatalf("server.NewSimpleDB: %v", err)
+	}
+	blk0 := file.NewBlockID("testfile", 0)
+	blk1 := file.NewBlockID("testfile", 1)
+	blk2 := file.NewBlockID("testfile", 2)
+
+	tx1 := db.NewTx()
+	if err := tx1.Unpin(blk0); !errors.Is(err, buffer.ErrNotPinned) {
+		t.Errorf("tx1.Unpin of a block not pinned: got %v, want ErrNotPinned", err)
+	}
+	for _, blk := range []file.BlockID{blk0, blk1, blk1} { // pinning blk1 again needs no other buffer
+		if err := tx1.Pin(blk); err != nil {
+			t.Fatalf("tx1.Pin(%v): %v", blk, err)
+		}
+	}
+	var limitErr *buffer.PinLimitError
+	if err := tx1.Pin(blk2); !errors.As(err, &limitErr) || limitErr.Limit != 2 {
+		t.Fatalf("tx1.Pin beyond the limit: got %v, want PinLimitError", err)
+	}
+	// another transaction has its own limit
+	tx2 := db.NewTx()
+	if err := tx2.Pin(blk2); err != nil {
+		t.Fatalf("tx2.Pin: %v", err)
+	}
+	if err := tx2.Unpin(blk2); err != nil {
+		t.Fatalf("tx2.Unpin: %v", err)
+	}
+	if err := tx2.Commit(); err != nil {
+		t.Fatalf("tx2.Commit: %v", err)
+	}
+	if len(leaks) != 0 {
+		t.Errorf("leaks of tx2=%v, want none", leaks)
+	}
+
+	if err := tx1.Unpin(blk0); err != nil {
+		t.Fatalf("tx1.Unpin: %v", err)
+	}
+	if err := tx1.Rollback(); err != nil {
+		t.Fatalf("tx1.Rollback: %v", err)
+	}
+	if want := []file.BlockID{blk1, blk1}; !slices.Equal(leaks, want) {
+		t.Errorf("leaks of tx1=%v, want %v", leaks, want)
+	}
+	if n := db.BufferManager.NumAvailable(); n != 8 {
+		t.Errorf("bm.NumAvailable()=%d, want 8", n)
+	}
+}
+
+func TestTransactionRecoveryAfterCrash(t *testing.T) {
+	t.Parallel()
+
+	blk := file.NewBlockID("testfile", 0)
+	open := func(t *testing.T, vfs file.VFS, d file.Durability) *server.SimpleDB {
+		t.Helper()
+		db, err := server.NewSimpleDB("crashtest", 400, 8,
+			server.WithFileOptions(file.WithVFS(vfs), file.WithDurability(d)))
+		if err != nil {
+			t.Fatalf("server.NewSimpleDB: %v", err)
+		}
+		return db
+	}
+	setInt := func(t *testing.T, tx *tx.Transaction, val int32) {
+		t.Helper()
+		if err := tx.Pin(blk); err != nil {
+			t.Fatalf("tx.Pin: %v", err)
+		}
+		if err := tx.SetInt(blk, 80, val, true); err != nil {
+			t.Fatalf("tx.SetInt: %v", err)
+		}
+	}
+	recoverInt := func(t *testing.T, db *server.SimpleDB) int32 {
+		t.Helper()
+		tx := db.NewTx()
+		if err := tx.Recover(); err != nil {
+			t.Fatalf("tx.Recover: %v", err)
+		}
+		if err := tx.Pin(blk); err != nil {
+			t.Fatalf("tx.Pin: %v", err)
+		}
+		val, err := tx.GetInt(blk, 80)
+		if err != nil {
+			t.Fatalf("tx.GetInt: %v", err)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatalf("tx.Commit: %v", err)
+		}
+		return val
+	}
+
+	for _, d := range []file.Durability{file.SyncAlways, file.SyncLog} {
+		t.Run(fmt.Sprintf("durability %d", d), func(t *testing.T) {
+			t.Parallel()
+
+			vfs := file.NewFaultVFS(file.NewMemVFS())
+			db := open(t, vfs, d)
+			if _, err := db.FileManager.Extend(blk.FileName); err != nil {
+				t.Fatalf("fm.Extend: %v", err)
+			}
+
+			tx1 := db.NewTx()
+			setInt(t, tx1, 111)
+			if err := tx1.Commit(); err != nil {
+				t.Fatalf("tx1.Commit: %v", err)
+			}
+			// the modification of tx2 reaches the disk before it commits
+			tx2 := db.NewTx()
+			setInt(t, tx2, 222)
+			if err := db.BufferManager.FlushAll(tx2.TxNum()); err != nil {
+				t.Fatalf("bm.FlushAll: %v", err)
+			}
+
+			if err := vfs.Crash(); err != nil {
+				t.Fatalf("vfs.Crash: %v", err)
+			}
+			if got := recoverInt(t, open(t, vfs, d)); got != 111 {
+				t.Errorf("value after recovery=%d, want the committed 111", got)
+			}
+		})
+	}
+
+	t.Run("failed commit", func(t *testing.T) {
+		t.Parallel()
+
+		vfs := file.NewFaultVFS(file.NewMemVFS())
+		db := open(t, vfs, file.SyncLog)
+		if _, err := db.FileManager.Extend(blk.FileName); err != nil {
+			t.Fatalf("fm.Extend: %v", err)
+		}
+		tx1 := db.NewTx()
+		setInt(t, tx1, 111)
+		if err := tx1.Commit(); err != nil {
+			t.Fatalf("tx1.Commit: %v", err)
+		}
+
+		tx2 := db.NewTx()
+		setInt(t, tx2, 222)
+		vfs.FailWrites(file.NewBlockID("simpledb.log", 0))
+		if err := tx2.Commit(); err == nil {
+			t.Fatalf("tx2.Commit succeeded while the log cannot be written")
+		}
+
+		vfs.ClearFaults()
+		if err := vfs.Crash(); err != nil {
+			t.Fatalf("vfs.Crash: %v", err)
+		}
+		if got := recoverInt(t, open(t, vfs, file.SyncLog)); got != 111 {
+			t.Errorf("value after recovery=%d, want the committed 111", got)
+		}
+	})
+}